@@ -0,0 +1,73 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/smallstep/truststore"
+)
+
+// applyCommand implements the "apply" command.
+func applyCommand(fs *flag.FlagSet) func([]string) error {
+	var filename string
+	var dryRun, backup, verbose bool
+	fs.StringVar(&filename, "f", "", "YAML, TOML or JSON configuration `file`, \"-\" reads YAML from the standard input")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print the changes that would be made")
+	fs.BoolVar(&backup, "backup", false, "save the files modified in a backup, see the restore command")
+	fs.BoolVar(&verbose, "v", false, "be verbose")
+	return func(args []string) error {
+		if filename == "" || len(args) != 0 {
+			return errUsage
+		}
+
+		config, err := loadConfig(filename)
+		if err != nil {
+			return err
+		}
+
+		opts := []truststore.Option{truststore.WithReporter(report)}
+		if dryRun {
+			opts = append(opts, truststore.WithDryRun())
+		}
+		if backup {
+			opts = append(opts, truststore.WithBackup(truststore.BackupDir()))
+		}
+		if verbose {
+			opts = append(opts, truststore.WithDebug())
+		}
+
+		changes, err := truststore.Apply(config, opts...)
+		for _, c := range changes {
+			if out != nil {
+				oc := out.certificate(c.Certificate)
+				oc.Changes = append(oc.Changes, outputResult{Store: c.Store, Action: string(c.Action)})
+			} else {
+				fmt.Println(c)
+			}
+		}
+		if err != nil || out != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Fprintln(os.Stderr, "no changes")
+		}
+		return nil
+	}
+}
+
+// loadConfig reads the configuration file, or YAML from the standard input
+// for "-".
+func loadConfig(filename string) (*truststore.Config, error) {
+	if filename != "-" {
+		return truststore.LoadConfig(filename)
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return truststore.ParseConfig(data, "yaml")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// completionCommand implements the "completion" command. It prints a script
+// that completes the commands, their flags and file names, e.g.
+//
+//	source <(truststore completion bash)
+func completionCommand(*flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		prog := filepath.Base(os.Args[0])
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout, prog)
+		case "zsh":
+			fmt.Printf("#compdef %s\n\nautoload -U +X bashcompinit && bashcompinit\n\n", prog)
+			writeBashCompletion(os.Stdout, prog)
+		case "fish":
+			writeFishCompletion(os.Stdout, prog)
+		default:
+			return usageError("unsupported shell %q", args[0])
+		}
+		return nil
+	}
+}
+
+// commandFlags returns the flags of the command.
+func commandFlags(c *command) []*flag.Flag {
+	fs := newFlagSet(c)
+	c.setup(fs)
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+func writeBashCompletion(w io.Writer, prog string) {
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	names := []string{"help"}
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s, generated by \"%s completion bash\".\n", prog, prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" flags=\"\"\n")
+	fmt.Fprintf(w, "\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "\t\treturn\n\tfi\n")
+	fmt.Fprintf(w, "\tcase \"${COMP_WORDS[1]}\" in\n")
+	for _, c := range commands {
+		var flags []string
+		for _, f := range commandFlags(c) {
+			flags = append(flags, "-"+f.Name)
+		}
+		if c.name == "completion" {
+			fmt.Fprintf(w, "\tcompletion)\n\t\tCOMPREPLY=($(compgen -W \"bash zsh fish\" -- \"$cur\"))\n\t\treturn\n\t\t;;\n")
+			continue
+		}
+		fmt.Fprintf(w, "\t%s) flags=%q ;;\n", c.name, strings.Join(flags, " "))
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\tfi\n}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, prog)
+}
+
+func writeFishCompletion(w io.Writer, prog string) {
+	fmt.Fprintf(w, "# fish completion for %s, generated by \"%s completion fish\".\n", prog, prog)
+	fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -a help -d %q\n", prog, "show the usage of a command")
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -a %s -d %q\n", prog, c.name, c.summary)
+		cond := fmt.Sprintf("'__fish_seen_subcommand_from %s'", c.name)
+		if c.name == "completion" {
+			fmt.Fprintf(w, "complete -c %s -n %s -f -a 'bash zsh fish'\n", prog, cond)
+			continue
+		}
+		for _, f := range commandFlags(c) {
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s -d %q\n", prog, cond, f.Name, firstLine(f.Usage))
+		}
+	}
+}
+
+// firstLine returns the first line of s without the backquotes used by the
+// flag package to name the arguments.
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	return strings.ReplaceAll(s, "`", "")
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/smallstep/truststore"
+)
+
+// exportCommand implements the "export" command.
+func exportCommand(fs *flag.FlagSet) func([]string) error {
+	var name, namespace, issuerKey, output string
+	var secret, bundle bool
+	fs.StringVar(&name, "name", "", "`name` of the resources, defaults to the truststore name of the first certificate")
+	fs.StringVar(&namespace, "namespace", "", "`namespace` of the ConfigMap or Secret with the bundle")
+	fs.BoolVar(&secret, "secret", false, "render the bundle in a Secret instead of a ConfigMap")
+	fs.StringVar(&issuerKey, "cluster-issuer", "", "render a cert-manager ClusterIssuer using the given private key `file`")
+	fs.BoolVar(&bundle, "bundle", false, "render a trust-manager Bundle")
+	fs.StringVar(&output, "o", "", "write the manifests to `file` instead of stdout")
+	return func(args []string) error {
+		if len(args) == 0 || args[0] != "k8s" {
+			return usageError("the only supported format is k8s")
+		}
+		// Flags are allowed after the format.
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		if fs.NArg() == 0 {
+			return errUsage
+		}
+		if out != nil {
+			if output == "" {
+				return usageError("the -o flag is required with -output json")
+			}
+			out.Output = output
+		}
+
+		certs, _, err := readCertificates(fs.Args())
+		if err != nil {
+			return err
+		}
+
+		var opts []truststore.KubernetesOption
+		if name != "" {
+			opts = append(opts, truststore.WithKubernetesName(name))
+		}
+		if namespace != "" {
+			opts = append(opts, truststore.WithKubernetesNamespace(namespace))
+		}
+		if secret {
+			opts = append(opts, truststore.WithKubernetesSecret())
+		}
+		if issuerKey != "" {
+			key, err := os.ReadFile(issuerKey)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, truststore.WithClusterIssuer(key))
+		}
+		if bundle {
+			opts = append(opts, truststore.WithTrustManagerBundle())
+		}
+
+		if output == "" {
+			return truststore.ExportKubernetes(os.Stdout, certs, opts...)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if err := truststore.ExportKubernetes(f, certs, opts...); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
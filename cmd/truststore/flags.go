@@ -0,0 +1,73 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/smallstep/truststore"
+)
+
+// trustFlags are the flags that select the truststores used by a command.
+type trustFlags struct {
+	java, firefox, auto, noSystem, user, all, backup, verbose bool
+	trustList, registries, caPath                             string
+}
+
+// register adds the flags to the flag set, verb describes the operation in
+// the usage, e.g. "install or uninstall".
+func (f *trustFlags) register(fs *flag.FlagSet, verb string) {
+	fs.BoolVar(&f.java, "java", false, verb+" on the Java truststore")
+	fs.BoolVar(&f.firefox, "firefox", false, verb+" on the Firefox truststore")
+	fs.BoolVar(&f.auto, "auto", false, verb+" on all the truststores detected on this machine")
+	fs.StringVar(&f.trustList, "trust", "", "comma separated list of truststores to "+verb+" on ("+trustNames()+")")
+	fs.StringVar(&f.registries, "registry", "", "comma separated list of container registries, host[:port], to "+verb+" on")
+	fs.StringVar(&f.caPath, "capath", "", "OpenSSL CApath `directory` to "+verb+" on")
+	fs.BoolVar(&f.noSystem, "no-system", false, "disables the "+verb+" on the system truststore")
+	fs.BoolVar(&f.user, "user", false, verb+" only on per-user locations, the system truststore is not modified")
+	fs.BoolVar(&f.all, "all", false, verb+" on the system, Firefox and Java truststores")
+	fs.BoolVar(&f.backup, "backup", false, "save the files modified in a backup, see the restore command")
+	fs.BoolVar(&f.verbose, "v", false, "be verbose")
+}
+
+// options returns the options for the selected truststores.
+func (f *trustFlags) options() ([]truststore.Option, error) {
+	opts := []truststore.Option{
+		truststore.WithReporter(report),
+	}
+	if f.auto {
+		opts = append(opts, truststore.WithAutoDetect())
+	}
+	if f.all || f.java {
+		opts = append(opts, truststore.WithJava())
+	}
+	if f.all || f.firefox {
+		opts = append(opts, truststore.WithFirefox())
+	}
+	if f.trustList != "" {
+		trustOpts, err := trustOptions(f.trustList)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, trustOpts...)
+	}
+	if f.registries != "" {
+		opts = append(opts, truststore.WithRegistry(splitList(f.registries)...))
+	}
+	if f.caPath != "" {
+		opts = append(opts, truststore.WithCAPath(f.caPath))
+	}
+	if f.noSystem {
+		opts = append(opts, truststore.WithNoSystem())
+	}
+	if f.user {
+		opts = append(opts, truststore.WithUserScope())
+	}
+	if f.backup {
+		opts = append(opts, truststore.WithBackup(truststore.BackupDir()))
+	}
+	if f.verbose {
+		opts = append(opts, truststore.WithDebug())
+	}
+	return opts, nil
+}
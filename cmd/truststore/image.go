@@ -0,0 +1,38 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/smallstep/truststore"
+)
+
+// imageCommand implements the "image" command. The image is an OCI image
+// layout, as a directory or a tarball, or a docker save tarball.
+func imageCommand(fs *flag.FlagSet) func([]string) error {
+	var output string
+	fs.StringVar(&output, "o", "", "write the new image to `path`, directories are modified in place by default")
+	return func(args []string) error {
+		if len(args) < 2 {
+			return errUsage
+		}
+		src := args[0]
+		if output == "" {
+			if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+				return usageError("the -o flag is required for image tarballs")
+			}
+			output = src
+		}
+		if out != nil {
+			out.Output = output
+		}
+
+		certs, _, err := readCertificates(args[1:])
+		if err != nil {
+			return err
+		}
+		return truststore.InjectImage(src, output, certs...)
+	}
+}
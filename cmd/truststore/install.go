@@ -0,0 +1,214 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/smallstep/truststore"
+)
+
+// installFlags are the flags of the install command.
+type installFlags struct {
+	trustFlags
+	noValidation    bool
+	nameConstraints string
+}
+
+func (f *installFlags) register(fs *flag.FlagSet, verb string) {
+	f.trustFlags.register(fs, verb)
+	fs.BoolVar(&f.noValidation, "no-validation", false, "install the certificate even if it is not suitable as a root certificate, see the lint command")
+	fs.StringVar(&f.nameConstraints, "require-name-constraints", "", "comma separated list of `domains`, refuse to install certificates unless their name constraints only permit them")
+}
+
+func (f *installFlags) options() ([]truststore.Option, error) {
+	opts, err := f.trustFlags.options()
+	if err != nil {
+		return nil, err
+	}
+	if f.noValidation {
+		opts = append(opts, truststore.WithNoValidation())
+	}
+	if f.nameConstraints != "" {
+		opts = append(opts, truststore.WithRequireNameConstraints(splitList(f.nameConstraints)))
+	}
+	return opts, nil
+}
+
+// installCommand implements the "install" command.
+func installCommand(fs *flag.FlagSet) func([]string) error {
+	var f installFlags
+	f.register(fs, "install")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		opts, err := f.options()
+		if err != nil {
+			return err
+		}
+		return forEachCertificate(args, func(cert *x509.Certificate) error {
+			return truststore.Install(cert, opts...)
+		})
+	}
+}
+
+// uninstallCommand implements the "uninstall" command.
+func uninstallCommand(fs *flag.FlagSet) func([]string) error {
+	var allManaged bool
+	var f trustFlags
+	fs.BoolVar(&allManaged, "all-managed", false, "uninstall all the certificates installed by truststore from the truststores where they were installed")
+	f.register(fs, "uninstall")
+	return func(args []string) error {
+		if (allManaged && len(args) != 0) || (!allManaged && len(args) == 0) {
+			return errUsage
+		}
+		opts, err := f.options()
+		if err != nil {
+			return err
+		}
+		if allManaged {
+			return uninstallManaged(opts)
+		}
+		return forEachCertificate(args, func(cert *x509.Certificate) error {
+			return truststore.Uninstall(cert, opts...)
+		})
+	}
+}
+
+// legacyCommand implements "truststore [-uninstall] rootCA.pem".
+func legacyCommand(fs *flag.FlagSet) func([]string) error {
+	var uninstall bool
+	var f installFlags
+	fs.BoolVar(&uninstall, "uninstall", false, "uninstall the given certificate")
+	f.register(fs, "install or uninstall")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		opts, err := f.options()
+		if err != nil {
+			return err
+		}
+		if uninstall && out != nil {
+			out.Command = "uninstall"
+		}
+		return forEachCertificate(args, func(cert *x509.Certificate) error {
+			if uninstall {
+				return truststore.Uninstall(cert, opts...)
+			}
+			return truststore.Install(cert, opts...)
+		})
+	}
+}
+
+// forEachCertificate runs fn with the certificates in the given files, "-"
+// reads them from the standard input. It continues after an error, and exits
+// with exitPartial if fn succeeded for some of the certificates. With -output
+// json the errors are added to the certificates in the output.
+func forEachCertificate(args []string, fn func(*x509.Certificate) error) error {
+	certs, names, err := readCertificates(args)
+	if err != nil {
+		return err
+	}
+
+	var ok int
+	var firstErr error
+	for i, cert := range certs {
+		if err := fn(cert); err != nil {
+			if out != nil {
+				out.certificate(cert).Error = newOutputError(err)
+			} else if len(certs) > 1 {
+				err = fmt.Errorf("%s: %w", names[i], err)
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ok++
+	}
+	switch {
+	case firstErr == nil:
+		return nil
+	case len(certs) == 1:
+		return firstErr
+	case ok > 0:
+		return exitStatus(exitPartial)
+	default:
+		return exitStatus(exitCode(firstErr))
+	}
+}
+
+// readCertificates reads the certificates in the given files, and returns them
+// with the name of their file. The standard input is read for "-", it can
+// contain multiple PEM certificates. With -output json the certificates are
+// added to the output.
+func readCertificates(args []string) ([]*x509.Certificate, []string, error) {
+	var certs []*x509.Certificate
+	var names []string
+	for _, filename := range args {
+		if filename != "-" {
+			cert, err := truststore.ReadCertificate(filename)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+			names = append(names, filename)
+			continue
+		}
+
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		stdin, err := parseCertificates(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing standard input: %w", err)
+		}
+		for _, cert := range stdin {
+			certs = append(certs, cert)
+			names = append(names, "-")
+		}
+	}
+	if out != nil {
+		for i, cert := range certs {
+			out.certificate(cert).File = names[i]
+		}
+	}
+	return certs, names, nil
+}
+
+// parseCertificates parses the PEM certificates in data, or a single DER
+// certificate.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, truststore.ErrInvalidCertificate
+	}
+	return []*x509.Certificate{cert}, nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/smallstep/truststore"
+)
+
+// lintCommand implements the "lint" command.
+func lintCommand(fs *flag.FlagSet) func([]string) error {
+	var nameConstraints string
+	fs.StringVar(&nameConstraints, "require-name-constraints", "", "comma separated list of `domains` the name constraints must be within")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+
+		var opts []truststore.Option
+		if nameConstraints != "" {
+			opts = append(opts, truststore.WithRequireNameConstraints(splitList(nameConstraints)))
+		}
+
+		certs, names, err := readCertificates(args)
+		if err != nil {
+			return err
+		}
+
+		var failed bool
+		for i, cert := range certs {
+			issues := truststore.Validate(cert, opts...)
+			if len(issues) == 0 && out == nil {
+				fmt.Printf("%s: ok\n", names[i])
+			}
+			for _, issue := range issues {
+				if out != nil {
+					c := out.certificate(cert)
+					c.Issues = append(c.Issues, outputIssue{Code: string(issue.Code), Severity: issue.Severity.String(), Message: issue.Message})
+				} else {
+					fmt.Printf("%s: %s [%s]\n", names[i], issue, issue.Code)
+				}
+				if issue.Severity == truststore.SeverityError {
+					failed = true
+				}
+			}
+		}
+		if failed {
+			return exitStatus(exitError)
+		}
+		return nil
+	}
+}
@@ -3,68 +3,342 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/smallstep/truststore"
 )
 
-func usage() {
-	fmt.Fprintf(os.Stderr, "Usage:\n\t%s [-uninstall] rootCA.pem\n", os.Args[0])
-	flag.PrintDefaults()
+// Exit codes of the CLI.
+const (
+	exitOK = iota
+	// exitUsage is used for invalid flags or arguments.
+	exitUsage
+	// exitError is used when the operation failed.
+	exitError
+	// exitPartial is used when the operation failed in some truststores or
+	// for some certificates, but not in all of them.
+	exitPartial
+	// exitNotSupported is used when the operation is not supported on the
+	// system.
+	exitNotSupported
+	// exitPermission is used when the operation failed because of the file
+	// permissions or because sudo could not be used.
+	exitPermission
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the flags of the command and returns the function that
+	// runs it with the arguments left after parsing the flags.
+	setup func(fs *flag.FlagSet) func(args []string) error
 }
 
-func main() {
-	var uninstall, help, verbose bool
-	var java, firefox, noSystem, all bool
-	flag.Usage = usage
-	flag.BoolVar(&uninstall, "uninstall", false, "uninstall the given certificate")
-	flag.BoolVar(&java, "java", false, "install or uninstall on the Java truststore")
-	flag.BoolVar(&firefox, "firefox", false, "install or uninstall on the Firefox truststore")
-	flag.BoolVar(&noSystem, "no-system", false, "disables the install or uninstall on the system truststore")
-	flag.BoolVar(&all, "all", false, "install or uninstall on the system, Firefox and Java truststores")
-	flag.BoolVar(&verbose, "v", false, "be verbose")
-	flag.BoolVar(&help, "help", false, "show help")
-	flag.Parse()
+// commands are the subcommands of the CLI, they are set in init as the
+// completion command uses them.
+var commands []*command
 
-	if help {
-		flag.Usage()
-		os.Exit(0)
+func init() {
+	commands = []*command{
+		{"install", "[flags] rootCA.pem...", "install certificates", installCommand},
+		{"uninstall", "[flags] rootCA.pem... | -all-managed", "uninstall certificates", uninstallCommand},
+		{"list", "", "list the certificates installed by truststore", listCommand},
+		{"status", "[flags] [rootCA.pem...]", "show in which truststores the certificates are installed", statusCommand},
+		{"verify", "[flags] [-key rootCA.key | -leaf leaf.pem -leaf-key leaf.key] rootCA.pem...", "check that the certificates are installed, or trusted by the clients in a TLS handshake", verifyCommand},
+		{"apply", "[-dry-run] -f trust.yaml", "converge to the state in a configuration file", applyCommand},
+		{"prune", "[-dry-run] [flags]", "uninstall expired and superseded certificates", pruneCommand},
+		{"rotate", "[flags] old.pem new.pem", "replace a root certificate", rotateCommand},
+		{"restore", "[-dir directory] backup-id", "restore a backup", restoreCommand},
+		{"lint", "[flags] rootCA.pem...", "check if certificates are suitable as root certificates", lintCommand},
+		{"export", "k8s [flags] rootCA.pem...", "export certificates as Kubernetes manifests", exportCommand},
+		{"image", "[-o output] image rootCA.pem...", "add certificates to a container image", imageCommand},
+		{"watch", "[flags] [rootCA.pem...]", "install certificates in new browser profiles and JDKs", watchCommand},
+		{"completion", "bash|zsh|fish", "generate a shell completion script", completionCommand},
 	}
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
 
-	if len(flag.Args()) != 1 {
-		flag.Usage()
-		os.Exit(1)
+// errUsage is returned by the commands when the arguments are not valid.
+var errUsage = errors.New("invalid usage")
+
+// usageError returns an error that makes the command print its usage.
+func usageError(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), errUsage)
+}
+
+// exitStatus is returned by the commands that already printed the reason of
+// the failure.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// stats are the number of truststores in which an operation succeeded or
+// failed, they are used to detect partial failures.
+var stats struct {
+	succeeded, failed int
+}
+
+// exitCode returns the exit code for the error returned by a command.
+func exitCode(err error) int {
+	var status exitStatus
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &status):
+		return int(status)
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case isPermissionError(err):
+		return exitPermission
+	case errors.Is(err, truststore.ErrNotSupported), errors.Is(err, truststore.ErrTrustNotSupported):
+		return exitNotSupported
+	case stats.succeeded > 0:
+		return exitPartial
+	default:
+		return exitError
 	}
+}
 
+// isPermissionError returns if the error was caused by the file permissions or
+// by sudo.
+func isPermissionError(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	var cmdErr *truststore.CmdError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	out := bytes.ToLower(cmdErr.Out())
+	for _, s := range []string{"permission denied", "a password is required", "not in the sudoers", "access is denied"} {
+		if bytes.Contains(out, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustNames returns the names of the truststores, including the plugins in
+// the PATH.
+func trustNames() string {
+	names := truststore.Registered()
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, name := range truststore.Plugins() {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// trustOptions returns the options enabling the given comma separated list of
+// truststores. The names that are not registered truststores are plugins.
+func trustOptions(list string) ([]truststore.Option, error) {
 	var opts []truststore.Option
-	if all {
-		opts = append(opts, truststore.WithJava(), truststore.WithFirefox())
-	} else {
-		if java {
-			opts = append(opts, truststore.WithJava())
+	for _, name := range splitList(list) {
+		opt, err := truststore.WithLookup(name)
+		switch {
+		case errors.Is(err, truststore.ErrTrustNotFound):
+			return nil, usageError("unknown truststore %q, supported truststores are %s", name, trustNames())
+		case err != nil:
+			return nil, err
 		}
-		if firefox {
-			opts = append(opts, truststore.WithFirefox())
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// splitList splits a comma separated list.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
 		}
 	}
-	if noSystem {
-		opts = append(opts, truststore.WithNoSystem())
+	return list
+}
+
+// report prints the result of the operation on each truststore.
+func report(r truststore.Result) {
+	switch r.Action {
+	case truststore.ActionInstalled, truststore.ActionUninstalled, truststore.ActionExists:
+		stats.succeeded++
+	case truststore.ActionFailed:
+		stats.failed++
 	}
-	if verbose {
-		opts = append(opts, truststore.WithDebug())
+	if out != nil {
+		out.add(r)
+		return
 	}
 
-	if uninstall {
-		if err := truststore.UninstallFile(flag.Arg(0), opts...); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(2)
+	switch {
+	case r.Action == truststore.ActionFailed:
+		// errors are printed by main
+	case r.Action == truststore.ActionSkipped, r.Action == truststore.ActionDetected, r.Action == truststore.ActionNotDetected:
+		fmt.Fprintf(os.Stderr, "%s: %s, %s\n", r.Trust, r.Action, r.Reason)
+	case r.Action == truststore.ActionBackedUp:
+		fmt.Fprintf(os.Stderr, "%s: files saved in %s, restore them with \"%s restore %s\"\n", r.Trust, r.Path, os.Args[0], filepath.Base(r.Path))
+	case r.Path != "":
+		fmt.Fprintf(os.Stderr, "%s: certificate %s (%s)\n", r.Trust, r.Action, r.Path)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: certificate %s\n", r.Trust, r.Action)
+	}
+}
+
+// reportDetection reports only the results of the auto-detection, it is used
+// by the commands that print the other results themselves.
+func reportDetection(r truststore.Result) {
+	if r.Action == truststore.ActionDetected || r.Action == truststore.ActionNotDetected {
+		report(r)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n\t%s command [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"%s help command\" for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nExit status:\n\t%d  success\n\t%d  invalid usage\n\t%d  error\n\t%d  partial failure, the operation failed in some truststores\n\t%d  not supported on this system\n\t%d  insufficient permissions\n",
+		exitOK, exitUsage, exitError, exitPartial, exitNotSupported, exitPermission)
+}
+
+// outputFormat is the value of the -output flag.
+var outputFormat string
+
+// newFlagSet returns the flag set of the command with its usage, and the
+// -output flag common to all the commands.
+func newFlagSet(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	if c.name != "completion" {
+		fs.StringVar(&outputFormat, "output", "text", "output `format`, text or json")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s %s %s\n\n%s.\n", os.Args[0], c.name, c.args, strings.ToUpper(c.summary[:1])+c.summary[1:])
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(os.Stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// run parses the flags of the command, runs it, and returns the exit code.
+func run(c *command, args []string) int {
+	fs := newFlagSet(c)
+	fn := c.setup(fs)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := startOutput(c.name); err != nil {
+		return handle(fs, err)
+	}
+	return handle(fs, fn(fs.Args()))
+}
+
+// startOutput checks the -output flag, and starts collecting the JSON output
+// of the command.
+func startOutput(name string) error {
+	switch outputFormat {
+	case "", "text":
+		return nil
+	case "json":
+		out = &document{
+			Version:      outputVersion,
+			Command:      name,
+			Certificates: []*outputCertificate{},
 		}
-	} else {
-		if err := truststore.InstallFile(flag.Arg(0), opts...); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(2)
+		return nil
+	default:
+		return usageError("unsupported output format %q", outputFormat)
+	}
+}
+
+// handle prints the error returned by a command, or the JSON output, and
+// returns the exit code.
+func handle(fs *flag.FlagSet, err error) int {
+	var status exitStatus
+	switch {
+	case out != nil:
+		code := exitCode(err)
+		out.write(code, err)
+		return code
+	case err == nil:
+	case errors.Is(err, errUsage):
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, strings.TrimSuffix(err.Error(), ": "+errUsage.Error()))
 		}
+		fs.Usage()
+	case errors.As(err, &status):
+	default:
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return exitCode(err)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	switch name := os.Args[1]; name {
+	case "help", "-h", "-help", "--help":
+		if len(os.Args) > 2 {
+			if c := lookupCommand(os.Args[2]); c != nil {
+				fs := newFlagSet(c)
+				c.setup(fs)
+				fs.Usage()
+				os.Exit(exitOK)
+			}
+		}
+		usage()
+		os.Exit(exitOK)
+	default:
+		if c := lookupCommand(name); c != nil {
+			os.Exit(run(c, os.Args[2:]))
+		}
+	}
+
+	// Previous versions used "truststore [-uninstall] rootCA.pem".
+	legacy := &command{name: "", args: "[-uninstall] [flags] rootCA.pem", summary: "install or uninstall a certificate", setup: legacyCommand}
+	fs := newFlagSet(legacy)
+	fn := legacy.setup(fs)
+	fs.Usage = usage
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(exitUsage)
+	}
+	if err := startOutput("install"); err != nil {
+		os.Exit(handle(fs, err))
 	}
+	os.Exit(handle(fs, fn(fs.Args())))
 }
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/smallstep/truststore"
+)
+
+// uninstallManaged uninstalls all the certificates recorded in the manifest
+// from the truststores where they were installed.
+func uninstallManaged(opts []truststore.Option) error {
+	entries, err := truststore.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if out == nil {
+			fmt.Fprintln(os.Stderr, "no certificates installed by truststore found")
+		}
+		return nil
+	}
+	return truststore.UninstallManaged(append(opts, managedOptions(entries)...)...)
+}
+
+// managedOptions returns the options enabling the truststores recorded in the
+// manifest entries.
+func managedOptions(entries []truststore.ManifestEntry) []truststore.Option {
+	var opts []truststore.Option
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		switch e.Store {
+		case "system", "user":
+		case "capath":
+			for _, p := range e.Paths {
+				if dir := filepath.Dir(p); !seen["capath:"+dir] {
+					seen["capath:"+dir] = true
+					opts = append(opts, truststore.WithCAPath(dir))
+				}
+			}
+		case "registry":
+			for _, p := range e.Paths {
+				if host := filepath.Base(filepath.Dir(p)); !seen["registry:"+host] {
+					seen["registry:"+host] = true
+					hosts = append(hosts, host)
+				}
+			}
+		default:
+			if keystore := strings.TrimPrefix(e.Store, "java:"); keystore != e.Store && !seen[e.Store] {
+				seen[e.Store] = true
+				if t, err := truststore.NewJavaKeystoreTrust(keystore); err == nil {
+					opts = append(opts, truststore.WithTrust(t))
+				} else {
+					report(truststore.Result{Trust: e.Store, Action: truststore.ActionSkipped, Reason: err.Error()})
+				}
+			} else if !seen[e.Store] {
+				seen[e.Store] = true
+				if opt, err := truststore.WithLookup(e.Store); err == nil {
+					opts = append(opts, opt)
+				} else {
+					report(truststore.Result{Trust: e.Store, Action: truststore.ActionSkipped, Reason: err.Error()})
+				}
+			}
+		}
+	}
+	if len(hosts) > 0 {
+		opts = append(opts, truststore.WithRegistry(hosts...))
+	}
+	return opts
+}
+
+// manifestCertificates returns the certificates in the manifest entries,
+// without duplicates.
+func manifestCertificates(entries []truststore.ManifestEntry) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if seen[e.Fingerprint] {
+			continue
+		}
+		seen[e.Fingerprint] = true
+		cert, err := e.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// listCommand implements the "list" command.
+func listCommand(*flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+
+		entries, err := truststore.List()
+		if err != nil {
+			return err
+		}
+		if out != nil {
+			for i := range entries {
+				e := &entries[i]
+				cert, err := e.Certificate()
+				if err != nil {
+					return err
+				}
+				c := out.certificate(cert)
+				c.Results = append(c.Results, outputResult{
+					Store:       e.Store,
+					Action:      string(truststore.ActionExists),
+					Name:        e.Name,
+					Paths:       e.Paths,
+					InstalledAt: &e.InstalledAt,
+				})
+			}
+			return nil
+		}
+		if len(entries) == 0 {
+			fmt.Fprintln(os.Stderr, "no certificates installed by truststore found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FINGERPRINT\tSTORE\tNAME\tINSTALLED\tPATHS")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Fingerprint[:16], e.Store, e.Name,
+				e.InstalledAt.Local().Format("2006-01-02 15:04"), strings.Join(e.Paths, ","))
+		}
+		return w.Flush()
+	}
+}
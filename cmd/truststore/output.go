@@ -0,0 +1,158 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/smallstep/truststore"
+)
+
+// outputVersion is the version of the JSON output, it is incremented on
+// incompatible changes. The schema is documented in README.md.
+const outputVersion = 1
+
+// out collects the JSON output of a command, it is nil when the output is
+// text.
+var out *document
+
+// document is the JSON output of a command.
+type document struct {
+	Version  int    `json:"version"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+	// Error is the error that stopped the command.
+	Error        *outputError         `json:"error,omitempty"`
+	Certificates []*outputCertificate `json:"certificates"`
+	// Results are the results that do not refer to a single certificate.
+	Results []outputResult `json:"results,omitempty"`
+	// Files are the files modified by the restore command.
+	Files []outputFile `json:"files,omitempty"`
+	// Output is the file written by the export and image commands.
+	Output string `json:"output,omitempty"`
+}
+
+type outputCertificate struct {
+	File         string    `json:"file,omitempty"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	Fingerprint  string    `json:"fingerprint"`
+	NotAfter     time.Time `json:"notAfter"`
+	// Error is the error of the operation on this certificate.
+	Error   *outputError   `json:"error,omitempty"`
+	Results []outputResult `json:"results"`
+	// Issues are the validation issues found by the lint command.
+	Issues []outputIssue `json:"issues,omitempty"`
+	// Changes are the changes planned by the apply command.
+	Changes []outputResult `json:"changes,omitempty"`
+	// PruneReason and FoundIn are set by the prune command.
+	PruneReason string   `json:"pruneReason,omitempty"`
+	FoundIn     []string `json:"foundIn,omitempty"`
+}
+
+type outputResult struct {
+	Store  string       `json:"store"`
+	Action string       `json:"action"`
+	Path   string       `json:"path,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	Error  *outputError `json:"error,omitempty"`
+	// Name, Paths and InstalledAt are set by the list command.
+	Name        string     `json:"name,omitempty"`
+	Paths       []string   `json:"paths,omitempty"`
+	InstalledAt *time.Time `json:"installedAt,omitempty"`
+}
+
+type outputError struct {
+	Message string `json:"message"`
+	// Command and Output are the command that failed and its combined
+	// output.
+	Command string `json:"command,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+type outputIssue struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type outputFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+// newOutputError returns the JSON representation of the error, with the
+// command output of a truststore.CmdError.
+func newOutputError(err error) *outputError {
+	if err == nil {
+		return nil
+	}
+	e := &outputError{Message: err.Error()}
+	var cmdErr *truststore.CmdError
+	if errors.As(err, &cmdErr) {
+		if cmd := cmdErr.Cmd(); cmd != nil {
+			e.Command = strings.Join(cmd.Args, " ")
+		}
+		e.Output = string(cmdErr.Out())
+	}
+	return e
+}
+
+// certificate returns the entry of the certificate, adding it if necessary.
+func (d *document) certificate(cert *x509.Certificate) *outputCertificate {
+	sum := sha256.Sum256(cert.Raw)
+	fp := hex.EncodeToString(sum[:])
+	for _, c := range d.Certificates {
+		if c.Fingerprint == fp {
+			return c
+		}
+	}
+	c := &outputCertificate{
+		Subject:      cert.Subject.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		Fingerprint:  fp,
+		NotAfter:     cert.NotAfter.UTC(),
+		Results:      []outputResult{},
+	}
+	d.Certificates = append(d.Certificates, c)
+	return c
+}
+
+// add adds a result reported by the truststore package.
+func (d *document) add(r truststore.Result) {
+	res := outputResult{
+		Store:  r.Trust,
+		Action: string(r.Action),
+		Path:   r.Path,
+		Reason: r.Reason,
+		Error:  newOutputError(r.Err),
+	}
+	if r.Certificate == nil {
+		d.Results = append(d.Results, res)
+		return
+	}
+	c := d.certificate(r.Certificate)
+	c.Results = append(c.Results, res)
+}
+
+// write prints the document to the standard output.
+func (d *document) write(code int, err error) {
+	d.ExitCode = code
+	var status exitStatus
+	if err != nil && !errors.As(err, &status) {
+		d.Error = newOutputError(err)
+		if err != errUsage {
+			d.Error.Message = strings.TrimSuffix(d.Error.Message, ": "+errUsage.Error())
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(d)
+}
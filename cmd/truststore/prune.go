@@ -0,0 +1,52 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/smallstep/truststore"
+)
+
+// pruneCommand implements the "prune" command.
+func pruneCommand(fs *flag.FlagSet) func([]string) error {
+	var dryRun bool
+	var tf trustFlags
+	fs.BoolVar(&dryRun, "dry-run", false, "only list the certificates that would be uninstalled")
+	tf.register(fs, "prune")
+	return func(args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+
+		opts, err := tf.options()
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			opts = append(opts, truststore.WithDryRun())
+		}
+
+		stale, err := truststore.Prune(opts...)
+		for _, s := range stale {
+			cert := s.Certificate
+			if out != nil {
+				c := out.certificate(cert)
+				c.PruneReason, c.FoundIn = string(s.Reason), s.Trusts
+				continue
+			}
+			fmt.Printf("%s (serial %s, expires %s): %s, found in %s\n", cert.Subject.CommonName, cert.SerialNumber,
+				cert.NotAfter.Format("2006-01-02"), s.Reason, strings.Join(s.Trusts, ", "))
+		}
+		if err != nil || out != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			fmt.Fprintln(os.Stderr, "no stale certificates found")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/smallstep/truststore"
+)
+
+// restoreCommand implements the "restore" command. It restores the files saved
+// with the -backup flag and refreshes the system truststore if it was
+// modified.
+func restoreCommand(fs *flag.FlagSet) func([]string) error {
+	var dir string
+	fs.StringVar(&dir, "dir", truststore.BackupDir(), "`directory` with the backups")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		b, err := truststore.ReadBackup(dir, args[0])
+		if err != nil {
+			return err
+		}
+		if err := truststore.Restore(dir, args[0]); err != nil {
+			return err
+		}
+		for _, f := range b.Files {
+			if out != nil {
+				action := "restored"
+				if !f.Exists {
+					action = "removed"
+				}
+				out.Files = append(out.Files, outputFile{Path: f.Path, Action: action})
+				continue
+			}
+			if f.Exists {
+				fmt.Fprintf(os.Stderr, "%s: restored\n", f.Path)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: removed\n", f.Path)
+			}
+		}
+		return nil
+	}
+}
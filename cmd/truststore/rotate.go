@@ -0,0 +1,34 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/smallstep/truststore"
+)
+
+// rotateCommand implements the "rotate" command. It installs the new root
+// certificate, verifies it, and then uninstalls the old one.
+func rotateCommand(fs *flag.FlagSet) func([]string) error {
+	var tf trustFlags
+	tf.register(fs, "rotate")
+	return func(args []string) error {
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		opts, err := tf.options()
+		if err != nil {
+			return err
+		}
+		certs, _, err := readCertificates(args)
+		if err != nil {
+			return err
+		}
+		if len(certs) != 2 {
+			return usageError("the old and new certificates are required")
+		}
+		return truststore.Replace(certs[0], certs[1], opts...)
+	}
+}
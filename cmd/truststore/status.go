@@ -0,0 +1,228 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/smallstep/truststore"
+)
+
+// statusCommand implements the "status" command. Without arguments it shows
+// the certificates in the manifest, in the truststores where they were
+// installed.
+func statusCommand(fs *flag.FlagSet) func([]string) error {
+	var tf trustFlags
+	tf.register(fs, "check")
+	return func(args []string) error {
+		opts, err := tf.options()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, truststore.WithReporter(reportDetection))
+
+		var certs []*x509.Certificate
+		if len(args) > 0 {
+			if certs, _, err = readCertificates(args); err != nil {
+				return err
+			}
+		} else {
+			entries, err := truststore.List()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				if out == nil {
+					fmt.Fprintln(os.Stderr, "no certificates installed by truststore found")
+				}
+				return nil
+			}
+			if certs, err = manifestCertificates(entries); err != nil {
+				return err
+			}
+			opts = append(opts, managedOptions(entries)...)
+		}
+
+		if out != nil {
+			for _, cert := range certs {
+				for _, r := range truststore.Status(cert, opts...) {
+					out.add(r)
+				}
+			}
+			return nil
+		}
+
+		for i, cert := range certs {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s (%s)\n", certificateName(cert), shortFingerprint(cert))
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, r := range truststore.Status(cert, opts...) {
+				switch r.Action {
+				case truststore.ActionExists:
+					fmt.Fprintf(w, "  %s\tinstalled\n", r.Trust)
+				case truststore.ActionMissing:
+					fmt.Fprintf(w, "  %s\tnot installed\n", r.Trust)
+				default:
+					fmt.Fprintf(w, "  %s\tskipped, %s\n", r.Trust, r.Reason)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// verifyCommand implements the "verify" command. It fails if any of the
+// certificates is not installed in one of the enabled truststores. With -key
+// or -leaf it performs TLS handshakes with a local server and fails if any of
+// the clients does not trust the certificate.
+func verifyCommand(fs *flag.FlagSet) func([]string) error {
+	var keyFile, leafFile, leafKeyFile string
+	var tf trustFlags
+	tf.register(fs, "verify")
+	fs.StringVar(&keyFile, "key", "", "private key `file` of the certificate, used to issue a throwaway leaf certificate for a TLS handshake with each client")
+	fs.StringVar(&leafFile, "leaf", "", "leaf certificate `file` valid for localhost to use in a TLS handshake with each client, requires -leaf-key")
+	fs.StringVar(&leafKeyFile, "leaf-key", "", "private key `file` of the leaf certificate")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		opts, err := tf.options()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, truststore.WithReporter(reportDetection))
+
+		handshake := keyFile != "" || leafFile != ""
+		switch {
+		case keyFile != "" && leafFile != "":
+			return usageError("-key and -leaf cannot be used together")
+		case (leafFile == "") != (leafKeyFile == ""):
+			return usageError("-leaf and -leaf-key must be used together")
+		case handshake && len(args) != 1:
+			return usageError("only one certificate can be verified with -key or -leaf")
+		case keyFile != "":
+			key, err := readPrivateKey(keyFile)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, truststore.WithVerifyKey(key))
+		case leafFile != "":
+			leaf, err := tls.LoadX509KeyPair(leafFile, leafKeyFile)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, truststore.WithVerifyLeaf(leaf))
+		}
+
+		certs, names, err := readCertificates(args)
+		if err != nil {
+			return err
+		}
+
+		var trusted, untrusted int
+		for i, cert := range certs {
+			var results []truststore.Result
+			if handshake {
+				if results, err = truststore.Verify(cert, opts...); err != nil {
+					return err
+				}
+			} else {
+				results = truststore.Status(cert, opts...)
+			}
+			for _, r := range results {
+				switch r.Action {
+				case truststore.ActionExists, truststore.ActionTrusted:
+					trusted++
+				case truststore.ActionMissing, truststore.ActionNotTrusted, truststore.ActionFailed:
+					untrusted++
+				}
+				name := r.Trust
+				if handshake && r.Path != "" {
+					name += " (" + r.Path + ")"
+				}
+				switch {
+				case out != nil:
+					out.add(r)
+				case r.Action == truststore.ActionExists, r.Action == truststore.ActionTrusted:
+					fmt.Printf("%s: %s: trusted\n", names[i], name)
+				case r.Action == truststore.ActionMissing, r.Action == truststore.ActionNotTrusted:
+					fmt.Printf("%s: %s: not trusted\n", names[i], name)
+				case r.Action == truststore.ActionFailed:
+					fmt.Fprintf(os.Stderr, "%s: %s: failed, %v\n", names[i], name, r.Err)
+				default:
+					fmt.Fprintf(os.Stderr, "%s: %s: skipped, %s\n", names[i], name, r.Reason)
+				}
+			}
+		}
+		switch {
+		case untrusted == 0:
+			return nil
+		case trusted > 0:
+			return exitStatus(exitPartial)
+		default:
+			return exitStatus(exitError)
+		}
+	}
+}
+
+// readPrivateKey reads a PEM encoded PKCS #8, PKCS #1 or EC private key.
+func readPrivateKey(filename string) (crypto.Signer, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		var key interface{}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("error parsing %s: unsupported key type %T", filename, key)
+	}
+	return nil, fmt.Errorf("error parsing %s: no private key found", filename)
+}
+
+// certificateName returns the common name of the certificate, or its serial
+// number.
+func certificateName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return "serial " + cert.SerialNumber.String()
+}
+
+// shortFingerprint returns the first 16 hex digits of the SHA-256 fingerprint.
+func shortFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:8])
+}
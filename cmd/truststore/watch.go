@@ -0,0 +1,77 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/smallstep/truststore"
+)
+
+// watchCommand implements the "watch" command. It runs until it is
+// interrupted, installing the certificates in the new NSS security databases
+// and Java keystores. Without arguments it installs the certificates in the
+// manifest.
+func watchCommand(fs *flag.FlagSet) func([]string) error {
+	var nssDirs, javaDirs string
+	var noValidation, verbose bool
+	fs.StringVar(&nssDirs, "nss-dirs", "", "comma separated list of `directories` with NSS security databases in their subdirectories, defaults to the Firefox profiles and ~/.pki")
+	fs.StringVar(&javaDirs, "java-dirs", "", "comma separated list of `directories` where JDKs are installed, defaults to SDKMAN, asdf, IntelliJ IDEA and /usr/lib/jvm")
+	fs.BoolVar(&noValidation, "no-validation", false, "install the certificates even if they are not suitable as root certificates, see the lint command")
+	fs.BoolVar(&verbose, "v", false, "be verbose")
+	return func(args []string) error {
+		opts := []truststore.Option{truststore.WithReporter(func(r truststore.Result) {
+			report(r)
+			// Run does not return the errors of the installs.
+			if r.Action == truststore.ActionFailed && out == nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", r.Trust, r.Err)
+			}
+		})}
+		if noValidation {
+			opts = append(opts, truststore.WithNoValidation())
+		}
+		if verbose {
+			opts = append(opts, truststore.WithDebug())
+		}
+
+		var certs []*x509.Certificate
+		var err error
+		if len(args) > 0 {
+			if certs, _, err = readCertificates(args); err != nil {
+				return err
+			}
+		} else {
+			entries, err := truststore.List()
+			if err != nil {
+				return err
+			}
+			if certs, err = manifestCertificates(entries); err != nil {
+				return err
+			}
+		}
+		if len(certs) == 0 {
+			return fmt.Errorf("no certificates installed by truststore found")
+		}
+
+		w := truststore.NewWatcher(certs, opts...)
+		if nssDirs != "" {
+			w.NSSDirs = splitList(nssDirs)
+		}
+		if javaDirs != "" {
+			w.JavaDirs = splitList(javaDirs)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if out == nil {
+			fmt.Fprintf(os.Stderr, "watching for new NSS security databases and Java keystores, press Ctrl+C to stop\n")
+		}
+		return w.Run(ctx)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 var (
@@ -30,6 +31,29 @@ var (
 	ErrTrustNotSupported = errors.New("trust not supported")
 )
 
+// trustNotFoundError is the error returned by the constructors when the trust
+// is not available on the machine, it describes the cause and matches
+// ErrTrustNotFound.
+type trustNotFoundError struct {
+	cause string
+}
+
+// Error implements the error interface.
+func (e *trustNotFoundError) Error() string {
+	return e.cause
+}
+
+// Is returns if the target is ErrTrustNotFound, it is used by errors.Is.
+func (e *trustNotFoundError) Is(target error) bool {
+	return target == ErrTrustNotFound
+}
+
+// trustNotFound returns an error matching ErrTrustNotFound with the given
+// cause.
+func trustNotFound(format string, args ...interface{}) error {
+	return &trustNotFoundError{cause: fmt.Sprintf(format, args...)}
+}
+
 // CmdError is the error used when an executable fails.
 type CmdError struct {
 	err error
@@ -58,6 +82,11 @@ func (e *CmdError) Err() error {
 	return e.err
 }
 
+// Unwrap returns the internal error.
+func (e *CmdError) Unwrap() error {
+	return e.err
+}
+
 // Cmd returns the command executed.
 func (e *CmdError) Cmd() *exec.Cmd {
 	return e.cmd
@@ -68,6 +97,74 @@ func (e *CmdError) Out() []byte {
 	return e.out
 }
 
+// ValidationError is the error returned when a certificate is not suitable to
+// be installed. It contains all the issues found, including the warnings.
+type ValidationError struct {
+	Issues []Issue
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			msgs = append(msgs, issue.Message)
+		}
+	}
+	return "certificate validation failed: " + strings.Join(msgs, "; ")
+}
+
+// MultiError is the error returned when an operation fails in more than one
+// truststore. The operation continues in the other truststores after an
+// error.
+type MultiError struct {
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns if any of the errors matches the target, it is used by
+// errors.Is.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches the target, it is used by
+// errors.As.
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors returns nil without errors, the error if there is only one, or a
+// MultiError.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return &MultiError{Errors: errs}
+	}
+}
+
 func wrapError(err error, msg string) error {
 	if err == nil {
 		return nil
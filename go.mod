@@ -2,4 +2,8 @@ module github.com/smallstep/truststore
 
 go 1.18
 
-require howett.net/plist v1.0.1
+require (
+	github.com/BurntSushi/toml v1.3.2
+	gopkg.in/yaml.v3 v3.0.1
+	howett.net/plist v1.0.1
+)
@@ -4,11 +4,16 @@ package truststore
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"sync"
 )
 
 var prefix = ""
@@ -32,14 +37,16 @@ type Trust interface {
 }
 
 // Install installs the given certificate into the system truststore, and
-// optionally to the Firefox and Java trustores.
+// optionally to the Firefox and Java trustores. The truststores are used in
+// order of name, and a failure does not stop the install in the others, the
+// errors are returned in a MultiError if there is more than one.
 func Install(cert *x509.Certificate, opts ...Option) error {
 	filename, fn, err := saveTempCert(cert)
 	defer fn()
 	if err != nil {
 		return err
 	}
-	return installCertificate(filename, cert, opts)
+	return installCertificate(filename, cert, newOptions(opts))
 }
 
 // InstallFile will read the certificate in the given file and install it to the
@@ -49,29 +56,62 @@ func InstallFile(filename string, opts ...Option) error {
 	if err != nil {
 		return err
 	}
-	return installCertificate(filename, cert, opts)
+	return installCertificate(filename, cert, newOptions(opts))
 }
 
-func installCertificate(filename string, cert *x509.Certificate, opts []Option) error {
-	o := newOptions(opts)
+func installCertificate(filename string, cert *x509.Certificate, o *options) error {
+	if err := validateCertificate(cert, o); err != nil {
+		return err
+	}
+	if err := backup(cert, o); err != nil {
+		return err
+	}
 
-	for _, t := range o.trusts {
+	var errs []error
+	for _, t := range o.sortedTrusts() {
 		if err := t.PreCheck(); err != nil {
 			debug(err.Error())
+			o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error(), Certificate: cert})
 			continue
 		}
-		if !t.Exists(cert) {
-			if err := t.Install(filename, cert); err != nil {
-				return err
-			}
+		path := firstPath(trustPaths(t, cert))
+		if t.Exists(cert) {
+			// The certificate might have been installed before the manifest
+			// existed or by another tool.
+			recordInstall(t.Name(), trustPaths(t, cert), cert)
+			o.report(Result{Trust: t.Name(), Action: ActionExists, Path: path, Certificate: cert})
+			continue
+		}
+		if err := t.Install(filename, cert); err != nil {
+			o.report(Result{Trust: t.Name(), Action: ActionFailed, Err: err, Path: path, Certificate: cert})
+			errs = append(errs, err)
+			continue
 		}
+		recordInstall(t.Name(), trustPaths(t, cert), cert)
+		o.report(Result{Trust: t.Name(), Action: ActionInstalled, Path: path, Certificate: cert})
 	}
 
-	if o.withNoSystem {
-		return nil
+	switch {
+	case o.withUserScope:
+		o.report(Result{Trust: "system", Action: ActionSkipped, Reason: "user scope, the system truststore was not modified", Certificate: cert})
+		if err := installUserScope(cert); err != nil {
+			o.report(Result{Trust: "user", Action: ActionFailed, Err: err, Path: userBundleFilename(), Certificate: cert})
+			errs = append(errs, err)
+			break
+		}
+		recordInstall("user", []string{userBundleFilename()}, cert)
+		o.report(Result{Trust: "user", Action: ActionInstalled, Path: userBundleFilename(), Certificate: cert})
+	case o.withNoSystem:
+	default:
+		if err := installPlatform(filename, cert); err != nil {
+			o.report(Result{Trust: "system", Action: ActionFailed, Err: err, Path: firstPath(systemPaths(cert)), Certificate: cert})
+			errs = append(errs, err)
+			break
+		}
+		recordInstall("system", systemPaths(cert), cert)
+		o.report(Result{Trust: "system", Action: ActionInstalled, Path: firstPath(systemPaths(cert)), Certificate: cert})
 	}
-
-	return installPlatform(filename, cert)
+	return joinErrors(errs)
 }
 
 // Uninstall removes the given certificate from the system truststore, and
@@ -82,7 +122,7 @@ func Uninstall(cert *x509.Certificate, opts ...Option) error {
 	if err != nil {
 		return err
 	}
-	return uninstallCertificate(filename, cert, opts)
+	return uninstallCertificate(filename, cert, newOptions(opts))
 }
 
 // UninstallFile reads the certificate in the given file and removes it from the
@@ -92,27 +132,57 @@ func UninstallFile(filename string, opts ...Option) error {
 	if err != nil {
 		return err
 	}
-	return uninstallCertificate(filename, cert, opts)
+	return uninstallCertificate(filename, cert, newOptions(opts))
 }
 
-func uninstallCertificate(filename string, cert *x509.Certificate, opts []Option) error {
-	o := newOptions(opts)
+func uninstallCertificate(filename string, cert *x509.Certificate, o *options) error {
+	// Use the name recorded at install time, it might be different if the
+	// prefix has changed.
+	restore := useManagedName(cert)
+	defer restore()
+
+	if err := backup(cert, o); err != nil {
+		return err
+	}
 
-	for _, t := range o.trusts {
+	var errs []error
+	for _, t := range o.sortedTrusts() {
 		if err := t.PreCheck(); err != nil {
 			debug(err.Error())
+			o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error(), Certificate: cert})
 			continue
 		}
+		path := firstPath(trustPaths(t, cert))
 		if err := t.Uninstall(filename, cert); err != nil {
-			return err
+			o.report(Result{Trust: t.Name(), Action: ActionFailed, Err: err, Path: path, Certificate: cert})
+			errs = append(errs, err)
+			continue
 		}
+		recordUninstall(t.Name(), cert)
+		o.report(Result{Trust: t.Name(), Action: ActionUninstalled, Path: path, Certificate: cert})
 	}
 
-	if o.withNoSystem {
-		return nil
+	switch {
+	case o.withUserScope:
+		o.report(Result{Trust: "system", Action: ActionSkipped, Reason: "user scope, the system truststore was not modified", Certificate: cert})
+		if err := uninstallUserScope(cert); err != nil {
+			o.report(Result{Trust: "user", Action: ActionFailed, Err: err, Path: userBundleFilename(), Certificate: cert})
+			errs = append(errs, err)
+			break
+		}
+		recordUninstall("user", cert)
+		o.report(Result{Trust: "user", Action: ActionUninstalled, Path: userBundleFilename(), Certificate: cert})
+	case o.withNoSystem:
+	default:
+		if err := uninstallPlatform(filename, cert); err != nil {
+			o.report(Result{Trust: "system", Action: ActionFailed, Err: err, Path: firstPath(systemPaths(cert)), Certificate: cert})
+			errs = append(errs, err)
+			break
+		}
+		recordUninstall("system", cert)
+		o.report(Result{Trust: "system", Action: ActionUninstalled, Path: firstPath(systemPaths(cert)), Certificate: cert})
 	}
-
-	return uninstallPlatform(filename, cert)
+	return joinErrors(errs)
 }
 
 // ReadCertificate reads a certificate file and returns a x509.Certificate struct.
@@ -150,9 +220,71 @@ func SaveCertificate(filename string, cert *x509.Certificate) error {
 	return os.WriteFile(filename, pem.EncodeToMemory(block), 0600)
 }
 
+// Action is the action taken on a truststore.
+type Action string
+
+const (
+	// ActionInstalled indicates that the certificate was installed.
+	ActionInstalled Action = "installed"
+	// ActionUninstalled indicates that the certificate was uninstalled.
+	ActionUninstalled Action = "uninstalled"
+	// ActionExists indicates that the certificate was already installed.
+	ActionExists Action = "exists"
+	// ActionMissing indicates that the certificate is not installed.
+	ActionMissing Action = "missing"
+	// ActionSkipped indicates that the truststore was not used.
+	ActionSkipped Action = "skipped"
+	// ActionFailed indicates that the operation failed.
+	ActionFailed Action = "failed"
+	// ActionBackedUp indicates that the files were saved in a backup, the
+	// Path is the backup directory.
+	ActionBackedUp Action = "backed up"
+	// ActionTrusted indicates that a client trusted the certificate in a TLS
+	// handshake, see Verify.
+	ActionTrusted Action = "trusted"
+	// ActionNotTrusted indicates that a client did not trust the certificate
+	// in a TLS handshake, see Verify.
+	ActionNotTrusted Action = "not trusted"
+	// ActionDetected indicates that the trust was found on the machine and
+	// enabled, see WithAutoDetect. The Reason describes what was found.
+	ActionDetected Action = "detected"
+	// ActionNotDetected indicates that the trust was not found on the
+	// machine, see WithAutoDetect. The Reason describes why.
+	ActionNotDetected Action = "not detected"
+)
+
+// Result is the outcome of an operation on a single truststore.
+type Result struct {
+	Trust  string
+	Action Action
+	Path   string
+	Reason string
+	Err    error
+	// Certificate is the certificate of the operation, it is nil for the
+	// results that do not refer to a single certificate.
+	Certificate *x509.Certificate
+}
+
 type options struct {
-	withNoSystem bool
-	trusts       map[string]Trust
+	withNoSystem     bool
+	withUserScope    bool
+	withNoValidation bool
+	dryRun           bool
+	backupDir        string
+	// requireNameConstraints and allowedDomains are the validation policy
+	// set by WithRequireNameConstraints.
+	requireNameConstraints bool
+	allowedDomains         []string
+	trusts                 map[string]Trust
+	reporter               func(Result)
+	// verifyKey and verifyLeaf are used by Verify to get the certificate of
+	// the TLS server.
+	verifyKey  crypto.Signer
+	verifyLeaf *tls.Certificate
+	// detections are reported once, the first time that the option set by
+	// WithAutoDetect is used with a reporter.
+	detections   []Detection
+	detectReport *sync.Once
 }
 
 func newOptions(opts []Option) *options {
@@ -163,9 +295,41 @@ func newOptions(opts []Option) *options {
 	for _, fn := range opts {
 		fn(o)
 	}
+	if o.detectReport != nil && o.reporter != nil {
+		o.detectReport.Do(func() {
+			for _, d := range o.detections {
+				if d.Err != nil {
+					o.report(Result{Trust: d.Name, Action: ActionNotDetected, Reason: d.Err.Error()})
+				} else {
+					o.report(Result{Trust: d.Name, Action: ActionDetected, Reason: d.Reason})
+				}
+			}
+		})
+	}
 	return o
 }
 
+// sortedTrusts returns the enabled trusts sorted by name, so the operations
+// and the results are in the same order in every run.
+func (o *options) sortedTrusts() []Trust {
+	names := make([]string, 0, len(o.trusts))
+	for name := range o.trusts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	trusts := make([]Trust, len(names))
+	for i, name := range names {
+		trusts[i] = o.trusts[name]
+	}
+	return trusts
+}
+
+func (o *options) report(r Result) {
+	if o.reporter != nil {
+		o.reporter(r)
+	}
+}
+
 // Option is the type used to pass custom options.
 type Option func(*options)
 
@@ -176,28 +340,279 @@ func WithTrust(t Trust) Option {
 	}
 }
 
+// withConstructor enables the trust returned by a constructor, see
+// constructedTrust.
+func withConstructor(name string, t Trust, err error) Option {
+	return WithTrust(constructedTrust(name, t, err))
+}
+
+// constructedTrust returns the trust created by a constructor. If the trust is
+// not supported, the nil trust is returned, and its PreCheck returns a hint.
+// Other errors, including the cause of a trust not found, are kept in a
+// failedTrust with the given name, so they are reported instead of the hint.
+func constructedTrust(name string, t Trust, err error) Trust {
+	if err == nil || err == ErrTrustNotFound || err == ErrTrustNotSupported {
+		return t
+	}
+	return &failedTrust{name: name, err: err}
+}
+
+// failedTrust is a trust whose constructor failed, all the operations return
+// the error of the constructor.
+type failedTrust struct {
+	name string
+	err  error
+}
+
+// Name implements the Trust interface.
+func (t *failedTrust) Name() string {
+	return t.name
+}
+
+// Install implements the Trust interface.
+func (t *failedTrust) Install(string, *x509.Certificate) error {
+	return t.err
+}
+
+// Uninstall implements the Trust interface.
+func (t *failedTrust) Uninstall(string, *x509.Certificate) error {
+	return t.err
+}
+
+// Exists implements the Trust interface.
+func (t *failedTrust) Exists(*x509.Certificate) bool {
+	return false
+}
+
+// PreCheck implements the Trust interface.
+func (t *failedTrust) PreCheck() error {
+	return t.err
+}
+
 // WithJava enables the install or uninstall of a certificate in the Java
 // truststore.
 func WithJava() Option {
-	t, _ := NewJavaTrust()
-	return WithTrust(t)
+	t, err := NewJavaTrust()
+	return withConstructor("java", t, err)
 }
 
 // WithFirefox enables the install or uninstall of a certificate in the Firefox
 // truststore.
 func WithFirefox() Option {
-	t, _ := NewNSSTrust()
-	return WithTrust(t)
+	t, err := NewNSSTrust()
+	return withConstructor("nss", t, err)
+}
+
+// WithNode enables the install or uninstall of a certificate in the bundle
+// used by Node.js with NODE_EXTRA_CA_CERTS.
+func WithNode() Option {
+	t, err := NewNodeTrust()
+	return withConstructor("node", t, err)
+}
+
+// WithPython enables the install or uninstall of a certificate in the certifi
+// bundles used by Python.
+func WithPython() Option {
+	t, err := NewPythonTrust()
+	return withConstructor("python", t, err)
+}
+
+// WithPythonEnv enables the install or uninstall of a certificate in the
+// bundle exported with REQUESTS_CA_BUNDLE.
+func WithPythonEnv() Option {
+	t, err := NewPythonEnvTrust()
+	return withConstructor("python-env", t, err)
+}
+
+// WithRegistry enables the install or uninstall of a certificate as the CA of
+// the given container registries in Docker, containerd and Podman.
+func WithRegistry(hosts ...string) Option {
+	t, err := NewRegistryTrust(hosts...)
+	return withConstructor("registry", t, err)
+}
+
+// WithGit enables the install or uninstall of a certificate in the bundle
+// configured as http.sslCAInfo in the global gitconfig. If urls are given,
+// the bundle is configured with http.<url>.sslCAInfo for each of them.
+func WithGit(urls ...string) Option {
+	t, err := NewGitTrust(urls...)
+	return withConstructor("git", t, err)
+}
+
+// WithGo enables the install or uninstall of a certificate in the directory
+// exported with SSL_CERT_DIR for Go programs.
+func WithGo() Option {
+	t, err := NewGoTrust()
+	return withConstructor("go", t, err)
+}
+
+// WithRuby enables the install or uninstall of a certificate in the OpenSSL
+// certificate files of the Rubies owned by the user.
+func WithRuby() Option {
+	t, err := NewRubyTrust()
+	return withConstructor("ruby", t, err)
+}
+
+// WithPHP enables the install or uninstall of a certificate in the bundle
+// configured as openssl.cafile and curl.cainfo for PHP.
+func WithPHP() Option {
+	t, err := NewPHPTrust()
+	return withConstructor("php", t, err)
+}
+
+// WithDotNet enables the install or uninstall of a certificate in the .NET
+// CurrentUser\Root store.
+func WithDotNet() Option {
+	t, err := NewDotNetTrust()
+	return withConstructor("dotnet", t, err)
+}
+
+// WithCAPath enables the install or uninstall of a certificate in the given
+// OpenSSL CApath directory.
+func WithCAPath(dir string) Option {
+	t, err := NewCAPathTrust(dir)
+	return withConstructor("capath", t, err)
+}
+
+// WithChrome enables the install or uninstall of a certificate in the managed
+// policies of Chrome, Chromium, Brave and Edge.
+func WithChrome() Option {
+	t, err := NewChromePolicyTrust()
+	return withConstructor("chrome", t, err)
+}
+
+// WithFirefoxPolicy enables the install or uninstall of a certificate using
+// the Firefox enterprise policies.
+func WithFirefoxPolicy() Option {
+	t, err := NewFirefoxPolicyTrust()
+	return withConstructor("firefox-policy", t, err)
+}
+
+// autoDetectAlternatives are the trusts that WithAutoDetect only enables if
+// the trust they are an alternative to is not detected, indexed by name. Both
+// configure the same client in a different way.
+var autoDetectAlternatives = map[string]string{
+	"python-env": "python",
+}
+
+// WithAutoDetect enables all the registered trusts that are present on the
+// machine, see Available. The trusts enabled by other options are not
+// replaced. The detection of each trust is sent once to the reporter set with
+// WithReporter, with the action ActionDetected or ActionNotDetected, the
+// first time the option is used with a reporter.
+func WithAutoDetect() Option {
+	detections := Available()
+	present := make(map[string]bool)
+	for _, d := range detections {
+		present[d.Name] = d.Trust != nil
+	}
+	for i, d := range detections {
+		if alt, ok := autoDetectAlternatives[d.Name]; ok && d.Trust != nil && present[alt] {
+			detections[i] = Detection{Name: d.Name, Err: fmt.Errorf("%s is used instead", alt)}
+		}
+	}
+	once := new(sync.Once)
+	return func(o *options) {
+		for _, d := range detections {
+			if d.Trust == nil {
+				continue
+			}
+			if _, ok := o.trusts[d.Trust.Name()]; !ok {
+				o.trusts[d.Trust.Name()] = d.Trust
+			}
+		}
+		o.detections = detections
+		o.detectReport = once
+	}
 }
 
 // WithNoSystem disables the install or uninstall of a certificate in the system
-// truststore.
+// truststore. It does not disable the per-user locations of WithUserScope.
 func WithNoSystem() Option {
 	return func(o *options) {
 		o.withNoSystem = true
 	}
 }
 
+// WithNoValidation disables the validation of the certificate before
+// installing it. See Validate. The policies enabled with
+// WithRequireNameConstraints are still enforced.
+func WithNoValidation() Option {
+	return func(o *options) {
+		o.withNoValidation = true
+	}
+}
+
+// WithRequireNameConstraints refuses to install a certificate unless its name
+// constraints have permitted DNS domains, and all of them are within the
+// given domains, e.g. []string{".test", ".local"}. A domain with a leading
+// period only allows its subdomains. If no domains are given, any permitted
+// DNS domain is accepted.
+func WithRequireNameConstraints(domains []string) Option {
+	return func(o *options) {
+		o.requireNameConstraints = true
+		o.allowedDomains = domains
+	}
+}
+
+// WithUserScope installs or uninstalls the certificate only in per-user
+// locations. Instead of the system truststore, it maintains a user-owned CA
+// bundle with the system roots and the installed certificates, and environment
+// snippets that point SSL_CERT_FILE, REQUESTS_CA_BUNDLE and
+// NODE_EXTRA_CA_CERTS to it. The NSS trust is also enabled, and skipped if it
+// is not available.
+func WithUserScope() Option {
+	return func(o *options) {
+		o.withUserScope = true
+		if _, ok := o.trusts["nss"]; !ok {
+			t, err := NewNSSTrust()
+			o.trusts["nss"] = constructedTrust("nss", t, err)
+		}
+	}
+}
+
+// WithDryRun makes Prune only return the stale certificates without
+// uninstalling them.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithBackup saves the files that will be modified in a new directory in the
+// given directory before installing or uninstalling a certificate. The backup
+// can be restored with Restore.
+func WithBackup(dir string) Option {
+	return func(o *options) {
+		o.backupDir = dir
+	}
+}
+
+// WithVerifyKey sets the private key of the certificate, Verify uses it to
+// issue a throwaway leaf certificate for the TLS server.
+func WithVerifyKey(key crypto.Signer) Option {
+	return func(o *options) {
+		o.verifyKey = key
+	}
+}
+
+// WithVerifyLeaf sets the certificate used by the TLS server in Verify, the
+// chain must be issued by the verified certificate and be valid for
+// localhost.
+func WithVerifyLeaf(leaf tls.Certificate) Option {
+	return func(o *options) {
+		o.verifyLeaf = &leaf
+	}
+}
+
+// WithReporter sets a function that will be called with the result of the
+// operation on each truststore.
+func WithReporter(fn func(Result)) Option {
+	return func(o *options) {
+		o.reporter = fn
+	}
+}
+
 // WithDebug enables debug logging messages.
 func WithDebug() Option {
 	return func(o *options) {
@@ -213,6 +628,9 @@ func WithPrefix(s string) Option {
 }
 
 func uniqueName(cert *x509.Certificate) string {
+	if name, ok := nameOverride(cert); ok {
+		return name
+	}
 	switch {
 	case prefix != "":
 		return prefix + cert.SerialNumber.String()
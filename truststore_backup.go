@@ -0,0 +1,236 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// backupVersion is the version of the backup format.
+const backupVersion = 1
+
+// Backup describes a snapshot of the files modified by an operation, it is
+// saved as backup.json in the backup directory.
+type Backup struct {
+	Version   int          `json:"version"`
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Files     []BackupFile `json:"files"`
+	// System indicates that the system truststore was modified, and the
+	// system refresh command must run after a restore.
+	System bool `json:"system"`
+}
+
+// BackupFile is a file saved in a backup.
+type BackupFile struct {
+	Path string `json:"path"`
+	// Exists is false if the file did not exist, it will be removed on
+	// restore.
+	Exists bool        `json:"exists"`
+	Mode   os.FileMode `json:"mode,omitempty"`
+	SHA256 string      `json:"sha256,omitempty"`
+	// Backup is the path of the copy relative to the backup directory.
+	Backup string `json:"backup,omitempty"`
+	// Link is the target of a symbolic link, the link is restored instead of
+	// a copy.
+	Link string `json:"link,omitempty"`
+}
+
+// BackupDir returns the default directory for backups,
+// $XDG_STATE_HOME/truststore/backups.
+func BackupDir() string {
+	return filepath.Join(userStateDir(), "backups")
+}
+
+// backupFiles returns the files that the operation with the given options
+// will modify for the certificate, including the manifests.
+func backupFiles(cert *x509.Certificate, o *options) (files []string, system bool) {
+	files = append(files, manifestFilename("user"))
+	for _, t := range o.sortedTrusts() {
+		if t.PreCheck() == nil {
+			files = append(files, trustPaths(t, cert)...)
+		}
+	}
+	switch {
+	case o.withUserScope:
+		files = append(files, userBundleFilename())
+		files = append(files, envSnippetPaths("user")...)
+	case o.withNoSystem:
+	default:
+		files = append(files, manifestFilename("system"))
+		files = append(files, systemPaths(cert)...)
+		system = true
+	}
+	return files, system
+}
+
+// backup saves the files modified by the operation in a new directory in the
+// backup directory set by WithBackup. It does nothing if WithBackup is not
+// used.
+func backup(cert *x509.Certificate, o *options) error {
+	if o.backupDir == "" {
+		return nil
+	}
+
+	files, system := backupFiles(cert, o)
+	dir, id, err := newBackupDir(o.backupDir)
+	if err != nil {
+		return wrapError(err, "failed to create backup")
+	}
+
+	b := &Backup{
+		Version:   backupVersion,
+		ID:        id,
+		CreatedAt: time.Now().UTC(),
+		System:    system,
+	}
+	seen := make(map[string]bool)
+	for _, filename := range files {
+		if seen[filename] {
+			continue
+		}
+		seen[filename] = true
+
+		f := BackupFile{Path: filename}
+		st, err := os.Lstat(filename)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return wrapError(err, "failed to backup "+filename)
+		case st.Mode()&os.ModeSymlink != 0:
+			if f.Link, err = os.Readlink(filename); err != nil {
+				return wrapError(err, "failed to backup "+filename)
+			}
+			f.Exists = true
+		default:
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return wrapError(err, "failed to backup "+filename)
+			}
+			sum := sha256.Sum256(data)
+			f.Exists = true
+			f.Mode = st.Mode().Perm()
+			f.SHA256 = hex.EncodeToString(sum[:])
+			f.Backup = filepath.Join("files", strconv.Itoa(len(b.Files)))
+			if err := os.WriteFile(filepath.Join(dir, f.Backup), data, 0600); err != nil {
+				return wrapError(err, "failed to backup "+filename)
+			}
+		}
+		b.Files = append(b.Files, f)
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "backup.json"), append(data, '\n'), 0600); err != nil {
+		return wrapError(err, "failed to write backup")
+	}
+
+	debug("files backed up in %s", dir)
+	o.report(Result{Trust: "backup", Action: ActionBackedUp, Path: dir, Certificate: cert})
+	return nil
+}
+
+// newBackupDir creates a new directory for a backup named after the current
+// time.
+func newBackupDir(parent string) (string, string, error) {
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return "", "", err
+	}
+	base := time.Now().UTC().Format("20060102T150405Z")
+	for i := 0; ; i++ {
+		id := base
+		if i > 0 {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		dir := filepath.Join(parent, id)
+		if err := os.Mkdir(dir, 0700); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return "", "", err
+		}
+		return dir, id, os.Mkdir(filepath.Join(dir, "files"), 0700)
+	}
+}
+
+// ReadBackup reads the description of the backup with the given id in the
+// directory.
+func ReadBackup(dir, id string) (*Backup, error) {
+	filename := filepath.Join(dir, id, "backup.json")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Backup)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, wrapError(err, "error parsing "+filename)
+	}
+	if b.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", b.Version)
+	}
+	return b, nil
+}
+
+// Restore puts back the files saved in the backup with the given id in the
+// directory, removing the ones that did not exist, and runs the system refresh
+// command if the system truststore was modified. The checksums of all the
+// copies are verified before any file is restored.
+func Restore(dir, id string) error {
+	b, err := ReadBackup(dir, id)
+	if err != nil {
+		return err
+	}
+
+	data := make([][]byte, len(b.Files))
+	for i, f := range b.Files {
+		if !f.Exists || f.Link != "" {
+			continue
+		}
+		if data[i], err = os.ReadFile(filepath.Join(dir, id, f.Backup)); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data[i])
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return fmt.Errorf("backup of %s is corrupted, checksum does not match", f.Path)
+		}
+	}
+
+	for i, f := range b.Files {
+		// A file replaced by a link, or a link, is removed first, so the
+		// data is not written to the link target.
+		if st, err := os.Lstat(f.Path); err == nil && (f.Link != "" || st.Mode()&os.ModeSymlink != 0) {
+			if err := removeFileAsRoot(f.Path); err != nil {
+				return wrapError(err, "failed to restore "+f.Path)
+			}
+		}
+		switch {
+		case f.Link != "":
+			err = symlinkAsRoot(f.Link, f.Path)
+		case f.Exists:
+			err = writeFileAsRoot(f.Path, data[i], f.Mode)
+		default:
+			err = removeFileAsRoot(f.Path)
+		}
+		if err != nil {
+			return wrapError(err, "failed to restore "+f.Path)
+		}
+		debug("restored %s", f.Path)
+	}
+
+	if b.System {
+		if err := refreshPlatform(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+)
+
+const (
+	bundleHeader      = "# This file is managed by truststore, do not edit.\n"
+	bundleBeginMarker = "# truststore begin: "
+	bundleEndMarker   = "# truststore end: "
+)
+
+// appendBundleCertificate appends the given certificate to the PEM data
+// surrounded by the truststore markers.
+func appendBundleCertificate(data []byte, cert *x509.Certificate) []byte {
+	var buf bytes.Buffer
+	buf.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(bundleBeginMarker + uniqueName(cert) + "\n")
+	buf.Write(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	}))
+	buf.WriteString(bundleEndMarker + uniqueName(cert) + "\n")
+	return buf.Bytes()
+}
+
+// removeBundleCertificate removes the truststore blocks containing the given
+// certificate from the PEM data. It returns the new data and if any block was
+// removed.
+func removeBundleCertificate(data []byte, cert *x509.Certificate) ([]byte, bool) {
+	var buf, block bytes.Buffer
+	var inBlock, removed bool
+	for _, line := range bundleLines(data) {
+		switch {
+		case !inBlock && bytes.HasPrefix(line, []byte(bundleBeginMarker)):
+			inBlock = true
+			block.Reset()
+			block.Write(line)
+			block.WriteByte('\n')
+		case inBlock && bytes.HasPrefix(line, []byte(bundleEndMarker)):
+			inBlock = false
+			block.Write(line)
+			block.WriteByte('\n')
+			if c := parseBundleBlock(block.Bytes()); c != nil && c.Equal(cert) {
+				removed = true
+				continue
+			}
+			buf.Write(block.Bytes())
+		case inBlock:
+			block.Write(line)
+			block.WriteByte('\n')
+		default:
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	// Keep an unterminated block as it is.
+	if inBlock {
+		buf.Write(block.Bytes())
+	}
+	return buf.Bytes(), removed
+}
+
+// bundleLines splits the data in lines without the line endings. Unlike
+// bufio.Scanner, it has no limit in the length of the lines, so the bundles
+// are never truncated.
+func bundleLines(data []byte) [][]byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return nil
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	return lines
+}
+
+// bundleCertificates returns the certificates in the truststore blocks of the
+// given PEM data.
+func bundleCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, e := range bundleEntries(data) {
+		certs = append(certs, e.Certificate)
+	}
+	return certs
+}
+
+// bundleEntries returns the certificates in the truststore blocks of the given
+// PEM data with the names in the markers.
+func bundleEntries(data []byte) []Entry {
+	var entries []Entry
+	var block bytes.Buffer
+	var name string
+	var inBlock bool
+	for _, line := range bundleLines(data) {
+		switch {
+		case !inBlock && bytes.HasPrefix(line, []byte(bundleBeginMarker)):
+			inBlock = true
+			name = string(bytes.TrimPrefix(line, []byte(bundleBeginMarker)))
+			block.Reset()
+		case inBlock && bytes.HasPrefix(line, []byte(bundleEndMarker)):
+			inBlock = false
+			if c := parseBundleBlock(block.Bytes()); c != nil {
+				entries = append(entries, Entry{Name: name, Certificate: c})
+			}
+		case inBlock:
+			block.Write(line)
+			block.WriteByte('\n')
+		}
+	}
+	return entries
+}
+
+// bundleContains returns if the given certificate is in one of the truststore
+// blocks of the PEM data.
+func bundleContains(data []byte, cert *x509.Certificate) bool {
+	for _, c := range bundleCertificates(data) {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseBundleBlock(data []byte) *x509.Certificate {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		return cert
+	}
+}
+
+// systemRoots returns the PEM data of the first system CA bundle found.
+func systemRoots() []byte {
+	for _, filename := range SystemBundleFiles {
+		if b, err := os.ReadFile(filename); err == nil {
+			debug("using system roots from %s", filename)
+			return removeAllBundleCertificates(b)
+		}
+	}
+	return nil
+}
+
+// removeAllBundleCertificates removes all the truststore blocks from the PEM
+// data.
+func removeAllBundleCertificates(data []byte) []byte {
+	for _, c := range bundleCertificates(data) {
+		data, _ = removeBundleCertificate(data, c)
+	}
+	return data
+}
+
+// caBundle is a PEM file maintained by truststore with the installed
+// certificates and, optionally, a copy of the system roots.
+type caBundle struct {
+	path        string
+	systemRoots bool
+}
+
+// certificates returns the certificates installed by truststore in the bundle.
+func (b *caBundle) certificates() []*x509.Certificate {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil
+	}
+	return bundleCertificates(data)
+}
+
+// entries returns the certificates installed by truststore in the bundle with
+// their names.
+func (b *caBundle) entries() []Entry {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil
+	}
+	return bundleEntries(data)
+}
+
+// contains returns if the given certificate is in the bundle.
+func (b *caBundle) contains(cert *x509.Certificate) bool {
+	for _, c := range b.certificates() {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds the certificate to the bundle, the system roots are refreshed.
+func (b *caBundle) add(cert *x509.Certificate) error {
+	certs := b.certificates()
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return b.write(certs)
+		}
+	}
+	return b.write(append(certs, cert))
+}
+
+// remove removes the certificate from the bundle. The bundle file is deleted
+// if there are no certificates left. It returns if the bundle is now empty.
+func (b *caBundle) remove(cert *x509.Certificate) (bool, error) {
+	var certs []*x509.Certificate
+	for _, c := range b.certificates() {
+		if !c.Equal(cert) {
+			certs = append(certs, c)
+		}
+	}
+	return len(certs) == 0, b.write(certs)
+}
+
+func (b *caBundle) write(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data := []byte(bundleHeader)
+	if b.systemRoots {
+		data = append(data, systemRoots()...)
+	}
+	for _, c := range certs {
+		data = appendBundleCertificate(data, c)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	//nolint:gosec // the bundle only contains public certificates
+	return os.WriteFile(b.path, data, 0644)
+}
+
+// addToPEMFile adds the certificate to the given PEM file. If the file does
+// not exist, it is created with a copy of the system roots.
+func addToPEMFile(filename string, cert *x509.Certificate) error {
+	data, err := os.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+		data = append([]byte(bundleHeader), systemRoots()...)
+	case err != nil:
+		return err
+	case bundleContains(data, cert):
+		return nil
+	}
+	//nolint:gosec // the bundle only contains public certificates
+	return os.WriteFile(filename, appendBundleCertificate(data, cert), 0644)
+}
+
+// removeFromPEMFile removes the certificate from the given PEM file. The file
+// is deleted if it was created by addToPEMFile and there are no certificates
+// left.
+func removeFromPEMFile(filename string, cert *x509.Certificate) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, ok := removeBundleCertificate(data, cert)
+	switch {
+	case !ok:
+		return nil
+	case bytes.HasPrefix(data, []byte(bundleHeader)) && len(bundleCertificates(data)) == 0:
+		return os.Remove(filename)
+	default:
+		//nolint:gosec // the bundle only contains public certificates
+		return os.WriteFile(filename, data, 0644)
+	}
+}
+
+// pemFileEntries returns the certificates added to the given PEM file by
+// addToPEMFile.
+func pemFileEntries(filename string) ([]Entry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return bundleEntries(data), nil
+}
+
+// pemFileContains returns if the certificate has been added to the given PEM
+// file.
+func pemFileContains(filename string, cert *x509.Certificate) bool {
+	data, err := os.ReadFile(filename)
+	return err == nil && bundleContains(data, cert)
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // required by the OpenSSL subject hash
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CAPathTrust implements a Trust for an OpenSSL CApath, a directory where the
+// certificates are looked up by <subject-hash>.<n> links, as created by
+// c_rehash or "openssl rehash". The hash is computed without the openssl
+// binary.
+type CAPathTrust struct {
+	dir string
+}
+
+// NewCAPathTrust creates a new CAPathTrust for the given directory.
+func NewCAPathTrust(dir string) (*CAPathTrust, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("capath trust requires a directory")
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &CAPathTrust{
+		dir: dir,
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *CAPathTrust) Name() string {
+	return "capath"
+}
+
+// Install implements the Trust interface. It writes the certificate in the
+// directory and links it with the first free <subject-hash>.<n> name.
+func (t *CAPathTrust) Install(_ string, cert *x509.Certificate) error {
+	hash, err := SubjectHash(cert)
+	if err != nil {
+		return err
+	}
+
+	name := strings.ReplaceAll(uniqueName(cert), " ", "_") + ".pem"
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+	if err := writeFileAsRoot(filepath.Join(t.dir, name), data, 0644); err != nil {
+		return wrapError(err, "failed to write "+name)
+	}
+
+	links := t.links(hash)
+	for _, link := range links {
+		if t.linksTo(link, cert) {
+			debug("certificate already linked as %s", link)
+			return nil
+		}
+	}
+	link := fmt.Sprintf("%08x.%d", hash, len(links))
+	if err := symlinkAsRoot(name, filepath.Join(t.dir, link)); err != nil {
+		return wrapError(err, "failed to create "+link)
+	}
+
+	debug("certificate installed properly in %s as %s", t.dir, link)
+	return nil
+}
+
+// Uninstall implements the Trust interface. The links after the removed ones
+// are renumbered, OpenSSL stops the lookup at the first missing link.
+func (t *CAPathTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	hash, err := SubjectHash(cert)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for _, link := range t.links(hash) {
+		filename := filepath.Join(t.dir, link)
+		if t.linksTo(link, cert) {
+			if err := removeFileAsRoot(filename); err != nil {
+				return err
+			}
+			continue
+		}
+		if next := fmt.Sprintf("%08x.%d", hash, n); next != link {
+			if err := renameAsRoot(filename, filepath.Join(t.dir, next)); err != nil {
+				return err
+			}
+		}
+		n++
+	}
+
+	name := strings.ReplaceAll(uniqueName(cert), " ", "_") + ".pem"
+	if err := removeFileAsRoot(filepath.Join(t.dir, name)); err != nil {
+		return err
+	}
+
+	debug("certificate uninstalled properly from %s", t.dir)
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if there is a link to
+// the certificate.
+func (t *CAPathTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	hash, err := SubjectHash(cert)
+	if err != nil {
+		return false
+	}
+	for _, link := range t.links(hash) {
+		if t.linksTo(link, cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// List implements the Lister interface. The links are not listed.
+func (t *CAPathTrust) List() ([]Entry, error) {
+	return listCertificateFiles(filepath.Join(t.dir, "*.pem")), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *CAPathTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf("warning: the CApath directory does not exist")
+}
+
+// paths implements the pathTrust interface. The paths include the links with
+// the subject hash of the certificate, that are created or renumbered, and
+// the next free link if the certificate is not linked.
+func (t *CAPathTrust) paths(cert *x509.Certificate) []string {
+	files := []string{filepath.Join(t.dir, strings.ReplaceAll(uniqueName(cert), " ", "_")+".pem")}
+	hash, err := SubjectHash(cert)
+	if err != nil {
+		return files
+	}
+	linked := false
+	links := t.links(hash)
+	for _, link := range links {
+		files = append(files, filepath.Join(t.dir, link))
+		linked = linked || t.linksTo(link, cert)
+	}
+	if !linked {
+		files = append(files, filepath.Join(t.dir, fmt.Sprintf("%08x.%d", hash, len(links))))
+	}
+	return files
+}
+
+// links returns the consecutive <hash>.<n> entries in the directory.
+func (t *CAPathTrust) links(hash uint32) []string {
+	var links []string
+	for i := 0; ; i++ {
+		link := fmt.Sprintf("%08x.%d", hash, i)
+		if _, err := os.Lstat(filepath.Join(t.dir, link)); err != nil {
+			return links
+		}
+		links = append(links, link)
+	}
+}
+
+// linksTo returns if the given entry contains the certificate.
+func (t *CAPathTrust) linksTo(link string, cert *x509.Certificate) bool {
+	c, err := ReadCertificate(filepath.Join(t.dir, link))
+	return err == nil && c.Equal(cert)
+}
+
+// SubjectHash returns the hash of the certificate subject used by OpenSSL to
+// look up certificates in a CApath, the same value returned by
+// "openssl x509 -hash". It is computed from the SHA-1 of the canonical
+// encoding of the name.
+func SubjectHash(cert *x509.Certificate) (uint32, error) {
+	canon, err := canonicalName(cert.RawSubject)
+	if err != nil {
+		return 0, wrapError(err, "error parsing certificate subject")
+	}
+	//nolint:gosec // required by the OpenSSL subject hash
+	sum := sha1.Sum(canon)
+	return binary.LittleEndian.Uint32(sum[:4]), nil
+}
+
+type attributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// canonicalName returns the canonical encoding of a name as in OpenSSL's
+// x509_name_canon: string values are converted to lowercase UTF8String
+// without leading, trailing or repeated spaces, and the RDNs are encoded
+// without the outer SEQUENCE.
+func canonicalName(rawName []byte) ([]byte, error) {
+	var rdns []asn1.RawValue
+	if rest, err := asn1.Unmarshal(rawName, &rdns); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+
+	var canon []byte
+	for _, rdn := range rdns {
+		if rdn.Class != asn1.ClassUniversal || rdn.Tag != asn1.TagSet {
+			return nil, asn1.StructuralError{Msg: "invalid relative distinguished name"}
+		}
+		var atvs [][]byte
+		for rest := rdn.Bytes; len(rest) > 0; {
+			var atv attributeTypeAndValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &atv); err != nil {
+				return nil, err
+			}
+			if s, ok := canonicalString(atv.Value); ok {
+				atv.Value = asn1.RawValue{
+					Class: asn1.ClassUniversal,
+					Tag:   asn1.TagUTF8String,
+					Bytes: []byte(s),
+				}
+			}
+			b, err := asn1.Marshal(atv)
+			if err != nil {
+				return nil, err
+			}
+			atvs = append(atvs, b)
+		}
+		// DER sorts the elements of a SET OF
+		sort.Slice(atvs, func(i, j int) bool {
+			return bytes.Compare(atvs[i], atvs[j]) < 0
+		})
+		set, err := asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassUniversal,
+			Tag:        asn1.TagSet,
+			IsCompound: true,
+			Bytes:      bytes.Join(atvs, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		canon = append(canon, set...)
+	}
+	return canon, nil
+}
+
+// canonicalString converts a string value to its canonical form. It returns
+// false if the value is not one of the string types canonicalized by OpenSSL.
+func canonicalString(v asn1.RawValue) (string, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return "", false
+	}
+
+	var s []byte
+	switch v.Tag {
+	case asn1.TagUTF8String:
+		s = v.Bytes
+	case asn1.TagPrintableString, asn1.TagIA5String, 26: // VisibleString
+		s = v.Bytes
+	case asn1.TagT61String:
+		// T61String is converted as ISO-8859-1
+		for _, c := range v.Bytes {
+			s = utf8.AppendRune(s, rune(c))
+		}
+	case asn1.TagBMPString:
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[2*i:])
+		}
+		s = []byte(string(utf16.Decode(u)))
+	case 28: // UniversalString
+		for i := 0; i+4 <= len(v.Bytes); i += 4 {
+			s = utf8.AppendRune(s, rune(binary.BigEndian.Uint32(v.Bytes[i:])))
+		}
+	default:
+		return "", false
+	}
+
+	isSpace := func(c byte) bool {
+		return c == ' ' || (c >= '\t' && c <= '\r')
+	}
+	s = bytes.TrimFunc(s, func(r rune) bool {
+		return r < utf8.RuneSelf && isSpace(byte(r))
+	})
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= utf8.RuneSelf:
+			out = append(out, c)
+		case isSpace(c):
+			out = append(out, ' ')
+			for i+1 < len(s) && isSpace(s[i+1]) {
+				i++
+			}
+		case c >= 'A' && c <= 'Z':
+			out = append(out, c+'a'-'A')
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out), true
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"testing"
+)
+
+func TestSubjectHash(t *testing.T) {
+	var (
+		oidCountry = asn1.ObjectIdentifier{2, 5, 4, 6}
+		oidOrg     = asn1.ObjectIdentifier{2, 5, 4, 10}
+		oidOrgUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+		oidCN      = asn1.ObjectIdentifier{2, 5, 4, 3}
+	)
+	utf8 := func(s string) asn1.RawValue {
+		return asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(s)}
+	}
+	printable := func(s string) asn1.RawValue {
+		return asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte(s)}
+	}
+	atv := func(oid asn1.ObjectIdentifier, v asn1.RawValue) pkix.AttributeTypeAndValue {
+		return pkix.AttributeTypeAndValue{Type: oid, Value: v}
+	}
+
+	// The expected values are the output of "openssl x509 -hash" for
+	// certificates with the same subjects.
+	tests := []struct {
+		name string
+		rdns pkix.RDNSequence
+		want uint32
+	}{
+		{"common name", pkix.RDNSequence{
+			{atv(oidCN, utf8("Test CA"))},
+		}, 0x3387b84d},
+		{"printable string", pkix.RDNSequence{
+			{atv(oidCN, printable("Test CA"))},
+		}, 0x3387b84d},
+		{"several attributes", pkix.RDNSequence{
+			{atv(oidCountry, printable("US"))},
+			{atv(oidOrg, utf8("Smallstep"))},
+			{atv(oidCN, utf8("Smallstep Root CA"))},
+		}, 0x28f0f857},
+		{"case and spaces", pkix.RDNSequence{
+			{atv(oidOrg, utf8("  Smallstep   Labs "))},
+			{atv(oidCN, utf8("ROOT  CA"))},
+		}, 0xe26ccd2c},
+		{"non ascii", pkix.RDNSequence{
+			{atv(oidCN, utf8("Ünïcode Root"))},
+		}, 0x6b089ad3},
+		{"multi-valued rdn", pkix.RDNSequence{
+			{atv(oidOrg, utf8("Smallstep"))},
+			{atv(oidCN, utf8("Multi")), atv(oidOrgUnit, utf8("Value"))},
+		}, 0xfa8cd2df},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := asn1.Marshal(tt.rdns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := SubjectHash(&x509.Certificate{RawSubject: raw})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("SubjectHash() = %08x, want %08x", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid subject", func(t *testing.T) {
+		if _, err := SubjectHash(&x509.Certificate{RawSubject: []byte{0x30, 0x03, 0x02, 0x01, 0x01}}); err == nil {
+			t.Error("SubjectHash() error = nil, want error")
+		}
+	})
+}
+
+func ExampleSubjectHash() {
+	raw, _ := asn1.Marshal(pkix.Name{CommonName: "Test CA"}.ToRDNSequence())
+	hash, _ := SubjectHash(&x509.Certificate{RawSubject: raw})
+	fmt.Printf("%08x.0\n", hash)
+	// Output: 3387b84d.0
+}
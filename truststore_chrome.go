@@ -0,0 +1,216 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// ChromePolicyDirs are the directories of the managed policies of the
+// Chromium based browsers on Linux.
+var ChromePolicyDirs = map[string]string{
+	"chrome":   "/etc/opt/chrome/policies/managed",
+	"chromium": "/etc/chromium/policies/managed",
+	"brave":    "/etc/brave/policies/managed",
+	"edge":     "/etc/opt/edge/policies/managed",
+}
+
+// chromeBinaries are the executables used to detect each browser.
+var chromeBinaries = map[string][]string{
+	"chrome":   {"google-chrome", "google-chrome-stable"},
+	"chromium": {"chromium", "chromium-browser"},
+	"brave":    {"brave-browser", "brave"},
+	"edge":     {"microsoft-edge", "microsoft-edge-stable"},
+}
+
+// chromePolicyName is the policy with the list of base64-encoded DER
+// certificates trusted for server authentication.
+const chromePolicyName = "CACertificates"
+
+// ChromePolicyTrust implements a Trust for Chrome, Chromium, Brave and Edge
+// using the CACertificates managed policy. It works regardless of the NSS
+// database used by the browser.
+type ChromePolicyTrust struct {
+	dirs []string
+}
+
+// NewChromePolicyTrust creates a new ChromePolicyTrust for the browsers
+// installed.
+func NewChromePolicyTrust() (*ChromePolicyTrust, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrTrustNotSupported
+	}
+
+	var names []string
+	for name := range ChromePolicyDirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var dirs []string
+	for _, name := range names {
+		dir := ChromePolicyDirs[name]
+		if chromeInstalled(name, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, trustNotFound("Chrome, Chromium, Brave or Edge not found")
+	}
+
+	return &ChromePolicyTrust{
+		dirs: dirs,
+	}, nil
+}
+
+func chromeInstalled(name, dir string) bool {
+	for _, bin := range chromeBinaries[name] {
+		if _, err := exec.LookPath(bin); err == nil {
+			return true
+		}
+	}
+	// e.g. /etc/opt/chrome
+	_, err := os.Stat(filepath.Dir(filepath.Dir(dir)))
+	return err == nil
+}
+
+// Name implements the Trust interface.
+func (t *ChromePolicyTrust) Name() string {
+	return "chrome"
+}
+
+// Install implements the Trust interface. The certificate is added to the
+// policy file that already defines CACertificates, or to truststore.json,
+// keeping the rest of the policies.
+func (t *ChromePolicyTrust) Install(_ string, cert *x509.Certificate) error {
+	value := base64.StdEncoding.EncodeToString(cert.Raw)
+	for _, dir := range t.dirs {
+		filename, policies, err := chromePolicyFile(dir)
+		if err != nil {
+			return err
+		}
+		certs := policyList(policies[chromePolicyName])
+		if containsString(certs, value) {
+			continue
+		}
+		policies[chromePolicyName] = append(certs, value)
+		if err := writeJSONFile(filename, policies); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate installed properly in %s", filename)
+	}
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *ChromePolicyTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	value := base64.StdEncoding.EncodeToString(cert.Raw)
+	for _, dir := range t.dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, filename := range files {
+			policies, err := readJSONFile(filename)
+			if err != nil {
+				return err
+			}
+			certs := policyList(policies[chromePolicyName])
+			if !containsString(certs, value) {
+				continue
+			}
+
+			var keep []string
+			for _, c := range certs {
+				if c != value {
+					keep = append(keep, c)
+				}
+			}
+			if len(keep) == 0 {
+				delete(policies, chromePolicyName)
+			} else {
+				policies[chromePolicyName] = keep
+			}
+
+			if len(policies) == 0 && filepath.Base(filename) == "truststore.json" {
+				err = removeFileAsRoot(filename)
+			} else {
+				err = writeJSONFile(filename, policies)
+			}
+			if err != nil {
+				return wrapError(err, "failed to write "+filename)
+			}
+			debug("certificate uninstalled properly from %s", filename)
+		}
+	}
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in the policies of all the browsers.
+func (t *ChromePolicyTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	value := base64.StdEncoding.EncodeToString(cert.Raw)
+	for _, dir := range t.dirs {
+		_, policies, err := chromePolicyFile(dir)
+		if err != nil || !containsString(policyList(policies[chromePolicyName]), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// PreCheck implements the Trust interface.
+func (t *ChromePolicyTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf("warning: Chrome, Chromium, Brave or Edge are not available")
+}
+
+// paths implements the pathTrust interface.
+func (t *ChromePolicyTrust) paths(_ *x509.Certificate) []string {
+	var files []string
+	for _, dir := range t.dirs {
+		if filename, _, err := chromePolicyFile(dir); err == nil {
+			files = append(files, filename)
+		}
+	}
+	return files
+}
+
+// chromePolicyFile returns the policy file in the given directory that
+// defines CACertificates, or truststore.json, and its policies.
+func chromePolicyFile(dir string) (string, map[string]interface{}, error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, filename := range files {
+		policies, err := readJSONFile(filename)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, ok := policies[chromePolicyName]; ok {
+			return filename, policies, nil
+		}
+	}
+	filename := filepath.Join(dir, "truststore.json")
+	policies, err := readJSONFile(filename)
+	return filename, policies, err
+}
+
+// policyList converts a JSON list to a list of strings.
+func policyList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	s := make([]string, 0, len(list))
+	for _, item := range list {
+		if str, ok := item.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
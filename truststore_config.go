@@ -0,0 +1,427 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the desired trust state of a machine, it can be read from a YAML,
+// TOML or JSON file with LoadConfig and applied with Apply.
+//
+// An example in YAML:
+//
+//	prefix: dev-
+//	stores: [system, nss, java]
+//	nss: [firefox, chrome]
+//	java:
+//	  keystores: [/opt/app/jre/lib/security/cacerts]
+//	policies:
+//	  requireNameConstraints: [.test]
+//	certificates:
+//	  - path: root_ca.crt
+//	  - path: old_root_ca.crt
+//	    state: absent
+type Config struct {
+	// Prefix is the prefix used to name the certificates, see WithPrefix.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix" toml:"prefix"`
+	// Stores are the default stores of the certificates, "system" if not set.
+	// The names are the ones returned by the trusts, "system" and "user".
+	Stores []string `json:"stores,omitempty" yaml:"stores" toml:"stores"`
+	// NSS are the NSS applications used by the "nss" store, "firefox",
+	// "chrome", or patterns of directories with NSS security databases.
+	NSS []string `json:"nss,omitempty" yaml:"nss" toml:"nss"`
+	// Java configures the "java" store.
+	Java JavaConfig `json:"java,omitempty" yaml:"java" toml:"java"`
+	// Registries are the container registries of the "registry" store.
+	Registries []string `json:"registries,omitempty" yaml:"registries" toml:"registries"`
+	// CAPath is the directory of the "capath" store.
+	CAPath       string              `json:"capath,omitempty" yaml:"capath" toml:"capath"`
+	Policies     PolicyConfig        `json:"policies,omitempty" yaml:"policies" toml:"policies"`
+	Certificates []CertificateConfig `json:"certificates" yaml:"certificates" toml:"certificates"`
+
+	// dir is the directory used to resolve relative paths.
+	dir string
+}
+
+// JavaConfig configures the Java keystores.
+type JavaConfig struct {
+	// Keystores are the keystores to use instead of the one in JAVA_HOME.
+	Keystores []string `json:"keystores,omitempty" yaml:"keystores" toml:"keystores"`
+	// StorePass is the password of the keystores, see JavaStorePass.
+	StorePass string `json:"storePass,omitempty" yaml:"storePass" toml:"storePass"`
+}
+
+// PolicyConfig are the validation policies, see Validate.
+type PolicyConfig struct {
+	// RequireNameConstraints are the allowed domains, see
+	// WithRequireNameConstraints.
+	RequireNameConstraints []string `json:"requireNameConstraints,omitempty" yaml:"requireNameConstraints" toml:"requireNameConstraints"`
+	// NoValidation installs certificates even if they are not suitable as
+	// root certificates, see WithNoValidation.
+	NoValidation bool `json:"noValidation,omitempty" yaml:"noValidation" toml:"noValidation"`
+}
+
+// CertificateState is the desired state of a certificate.
+type CertificateState string
+
+const (
+	// StatePresent indicates that the certificate must be installed.
+	StatePresent CertificateState = "present"
+	// StateAbsent indicates that the certificate must be uninstalled.
+	StateAbsent CertificateState = "absent"
+)
+
+// CertificateConfig is a certificate in the configuration.
+type CertificateConfig struct {
+	// Path is the certificate file, relative to the configuration file.
+	Path string `json:"path,omitempty" yaml:"path" toml:"path"`
+	// PEM is the certificate in PEM format, it is used instead of Path.
+	PEM string `json:"pem,omitempty" yaml:"pem" toml:"pem"`
+	// State is the desired state, StatePresent if not set.
+	State CertificateState `json:"state,omitempty" yaml:"state" toml:"state"`
+	// Stores are the stores of the certificate, the default ones if not set.
+	Stores []string `json:"stores,omitempty" yaml:"stores" toml:"stores"`
+}
+
+// LoadConfig reads the configuration in the given file. The format is
+// selected by the extension, ".json", ".toml", or YAML otherwise. Relative
+// certificate paths are resolved from the directory of the file.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var format string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		format = "json"
+	case ".toml":
+		format = "toml"
+	default:
+		format = "yaml"
+	}
+	c, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, wrapError(err, "error parsing "+filename)
+	}
+	c.dir = filepath.Dir(filename)
+	return c, nil
+}
+
+// ParseConfig parses a configuration in the given format, "yaml", "toml" or
+// "json". Unknown fields are an error. Relative certificate paths are resolved
+// from the current directory.
+func ParseConfig(data []byte, format string) (*Config, error) {
+	c := new(Config)
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return nil, err
+		}
+	case "toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return nil, err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return nil, fmt.Errorf("unknown field %q", keys[0].String())
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported configuration format %q", format)
+	}
+
+	for i, cc := range c.Certificates {
+		switch {
+		case cc.Path == "" && cc.PEM == "":
+			return nil, fmt.Errorf("certificate %d does not have a path or pem", i+1)
+		case cc.Path != "" && cc.PEM != "":
+			return nil, fmt.Errorf("certificate %d has both a path and pem", i+1)
+		}
+		switch cc.State {
+		case "", StatePresent, StateAbsent:
+		default:
+			return nil, fmt.Errorf("certificate %d has an invalid state %q, it must be %q or %q", i+1, cc.State, StatePresent, StateAbsent)
+		}
+	}
+	return c, nil
+}
+
+// certificate reads or parses the certificate.
+func (c *Config) certificate(cc CertificateConfig) (*x509.Certificate, error) {
+	if cc.PEM == "" {
+		filename := cc.Path
+		if !filepath.IsAbs(filename) && c.dir != "" {
+			filename = filepath.Join(c.dir, filename)
+		}
+		return ReadCertificate(filename)
+	}
+	block, _ := pem.Decode([]byte(cc.PEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificate
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// trusts returns the trusts for the given stores, and if the system truststore
+// or the per-user locations are used.
+func (c *Config) trusts(stores []string) (trusts []Trust, system, user bool, err error) {
+	for _, name := range stores {
+		switch name {
+		case "system":
+			system = true
+		case "user":
+			user = true
+		case "nss":
+			var t Trust
+			if len(c.NSS) == 0 {
+				nt, err := NewNSSTrust()
+				t = constructedTrust("nss", nt, err)
+			} else {
+				var patterns []string
+				for _, app := range c.NSS {
+					switch app {
+					case "firefox":
+						patterns = append(patterns, NSSProfile)
+					case "chrome", "chromium":
+						patterns = append(patterns, nssDB)
+					default:
+						patterns = append(patterns, app)
+					}
+				}
+				nt, err := NewNSSProfileTrust(patterns...)
+				t = constructedTrust("nss", nt, err)
+			}
+			trusts = append(trusts, t)
+		case "java":
+			if len(c.Java.Keystores) == 0 {
+				t, err := NewJavaTrust()
+				trusts = append(trusts, constructedTrust("java", t, err))
+			}
+			for _, keystore := range c.Java.Keystores {
+				t, err := NewJavaKeystoreTrust(keystore)
+				if err != nil {
+					return nil, false, false, wrapError(err, "error using java keystore "+keystore)
+				}
+				trusts = append(trusts, t)
+			}
+		case "registry":
+			if len(c.Registries) == 0 {
+				return nil, false, false, fmt.Errorf("registry store requires registries")
+			}
+			t, err := NewRegistryTrust(c.Registries...)
+			trusts = append(trusts, constructedTrust("registry", t, err))
+		case "capath":
+			t, err := NewCAPathTrust(c.CAPath)
+			if err != nil {
+				return nil, false, false, err
+			}
+			trusts = append(trusts, t)
+		default:
+			t, err := lookupTrust(name)
+			switch {
+			case errors.Is(err, ErrTrustNotFound):
+				return nil, false, false, fmt.Errorf("unknown store %q", name)
+			case err != nil:
+				return nil, false, false, wrapError(err, "error using store "+name)
+			}
+			trusts = append(trusts, t)
+		}
+	}
+	if system && user {
+		return nil, false, false, fmt.Errorf("stores %q and %q cannot be used together", "system", "user")
+	}
+	return trusts, system, user, nil
+}
+
+// Change is a change made by Apply to converge to the configuration.
+type Change struct {
+	Certificate *x509.Certificate
+	// Store is the name of the trust, "system" or "user".
+	Store string
+	// Action is ActionInstalled or ActionUninstalled.
+	Action Action
+	// Name is the name of the certificate in the store.
+	Name string
+}
+
+// String implements the fmt.Stringer interface.
+func (c Change) String() string {
+	sign := "+"
+	if c.Action == ActionUninstalled {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s %s: %s", sign, c.Store, c.Name)
+}
+
+// applyPlan are the changes for a certificate, the trusts, the system
+// truststore or the per-user locations where it must be installed, or
+// uninstalled if it is absent.
+type applyPlan struct {
+	cert         *x509.Certificate
+	absent       bool
+	trusts       map[string]Trust
+	system, user bool
+	changes      []Change
+}
+
+// Apply converges the machine to the configuration. It installs the present
+// certificates that are missing in their stores and uninstalls the absent ones
+// that are installed, so applying the same configuration again does not make
+// any change. It returns the changes made, also on error, with WithDryRun the
+// changes are only returned. All the certificates are read and validated
+// before making any change.
+//
+// The options are applied before the configuration, the prefix and the
+// policies in the configuration take precedence. The prefix and the Java
+// store password are only used during the call.
+func Apply(c *Config, opts ...Option) ([]Change, error) {
+	o := newOptions(opts)
+	defer func(p, pass string) {
+		prefix, JavaStorePass = p, pass
+	}(prefix, JavaStorePass)
+	if c.Prefix != "" {
+		prefix = c.Prefix
+	}
+	if c.Java.StorePass != "" {
+		JavaStorePass = c.Java.StorePass
+	}
+	if c.Policies.NoValidation {
+		o.withNoValidation = true
+	}
+	if len(c.Policies.RequireNameConstraints) > 0 {
+		o.requireNameConstraints = true
+		o.allowedDomains = c.Policies.RequireNameConstraints
+	}
+
+	var plans []*applyPlan
+	for i, cc := range c.Certificates {
+		cert, err := c.certificate(cc)
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("error reading certificate %d", i+1))
+		}
+		stores := cc.Stores
+		if len(stores) == 0 {
+			stores = c.Stores
+		}
+		if len(stores) == 0 {
+			stores = []string{"system"}
+		}
+		trusts, system, user, err := c.trusts(stores)
+		if err != nil {
+			return nil, err
+		}
+
+		present := cc.State != StateAbsent
+		if present {
+			if err := validateCertificate(cert, o); err != nil {
+				return nil, wrapError(err, fmt.Sprintf("error validating certificate %d", i+1))
+			}
+		}
+
+		p := &applyPlan{
+			cert:   cert,
+			absent: !present,
+			trusts: make(map[string]Trust),
+		}
+		add := func(store string, exists bool) bool {
+			switch {
+			case present && !exists:
+				p.changes = append(p.changes, Change{Certificate: cert, Store: store, Action: ActionInstalled, Name: uniqueName(cert)})
+				return true
+			case !present && exists:
+				p.changes = append(p.changes, Change{Certificate: cert, Store: store, Action: ActionUninstalled, Name: uniqueName(cert)})
+				return true
+			default:
+				return false
+			}
+		}
+		restore := useManagedName(cert)
+		for _, t := range trusts {
+			if err := t.PreCheck(); err != nil {
+				debug(err.Error())
+				o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error(), Certificate: cert})
+				continue
+			}
+			if add(t.Name(), t.Exists(cert)) {
+				p.trusts[t.Name()] = t
+			}
+		}
+		switch {
+		case system:
+			p.system = add("system", verifyPlatform(cert) == nil)
+		case user:
+			p.user = add("user", pemFileContains(userBundleFilename(), cert))
+		}
+		restore()
+		plans = append(plans, p)
+	}
+
+	var changes []Change
+	for _, p := range plans {
+		if o.dryRun {
+			changes = append(changes, p.changes...)
+			continue
+		}
+		done, err := p.apply(o)
+		changes = append(changes, done...)
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// apply installs or uninstalls the certificate in the stores of the plan. It
+// returns the changes made, the ones reported as done.
+func (p *applyPlan) apply(o *options) ([]Change, error) {
+	if len(p.trusts) == 0 && !p.system && !p.user {
+		return nil, nil
+	}
+
+	var done []Change
+	po := *o
+	po.trusts = p.trusts
+	po.withNoSystem = !p.system && !p.user
+	po.withUserScope = p.user
+	po.reporter = func(r Result) {
+		for _, c := range p.changes {
+			if c.Store == r.Trust && c.Action == r.Action {
+				done = append(done, c)
+			}
+		}
+		o.report(r)
+	}
+
+	filename, fn, err := saveTempCert(p.cert)
+	defer fn()
+	if err != nil {
+		return nil, err
+	}
+	if p.absent {
+		err = uninstallCertificate(filename, p.cert, &po)
+	} else {
+		err = installCertificate(filename, p.cert, &po)
+	}
+	return done, err
+}
@@ -20,6 +20,11 @@ var (
 
 	// CertutilInstallHelp is the command to run on macOS to add NSS support.
 	CertutilInstallHelp = "brew install nss"
+
+	// SystemBundleFiles are the possible locations of the system CA bundle.
+	SystemBundleFiles = []string{
+		"/etc/ssl/cert.pem",
+	}
 )
 
 // https://github.com/golang/go/issues/24652#issuecomment-399826583
@@ -122,6 +127,30 @@ func installPlatform(filename string, cert *x509.Certificate) error {
 	return nil
 }
 
+// verifyPlatform checks that the certificate is trusted by the platform
+// verifier.
+func verifyPlatform(cert *x509.Certificate) error {
+	_, err := cert.Verify(x509.VerifyOptions{})
+	return err
+}
+
+// refreshPlatform does nothing, the System keychain does not need to be
+// refreshed.
+func refreshPlatform() error {
+	return nil
+}
+
+// systemPaths returns the keychain where the certificate is installed.
+func systemPaths(*x509.Certificate) []string {
+	return []string{"/Library/Keychains/System.keychain"}
+}
+
+// listPlatform is not supported on macOS, the System keychain does not keep
+// the names used by truststore.
+func listPlatform() ([]Entry, error) {
+	return nil, ErrNotSupported
+}
+
 func uninstallPlatform(filename string, _ *x509.Certificate) error {
 	cmd := exec.Command("sudo", "security", "remove-trusted-cert", "-d", filename)
 	out, err := cmd.CombinedOutput()
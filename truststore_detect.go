@@ -0,0 +1,234 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Detector detects if a trust is present on the machine. If it is, it returns
+// the trust and the reason it was detected, e.g. the executable found.
+// Otherwise it returns an error with the reason it was not detected.
+type Detector func() (Trust, string, error)
+
+// Detection is the outcome of a Detector.
+type Detection struct {
+	Name   string
+	Trust  Trust
+	Reason string
+	Err    error
+}
+
+var (
+	detectorsMu sync.RWMutex
+	detectors   = make(map[string]Detector)
+)
+
+// Register makes a trust available by name with the given detector. The
+// built-in trusts are registered with their names, e.g. "java" or "nss";
+// registering one of these names replaces the built-in detector.
+func Register(name string, d Detector) {
+	if name == "" || d == nil {
+		panic("truststore: Register with an empty name or a nil detector")
+	}
+	detectorsMu.Lock()
+	detectors[name] = d
+	detectorsMu.Unlock()
+}
+
+// Lookup returns the trust with the given name if it is present on the
+// machine. The plugins in the PATH are used if no trust is registered with the
+// name. It returns ErrTrustNotFound if the trust is unknown, and the reason
+// the trust was not detected if it is not present.
+func Lookup(name string) (Trust, error) {
+	detectorsMu.RLock()
+	d, ok := detectors[name]
+	detectorsMu.RUnlock()
+	if !ok {
+		t, err := NewPluginTrust(name)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	t, _, err := d()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WithLookup returns the option enabling the trust with the given name, see
+// Lookup. A registered trust that is not present is still enabled, and it is
+// skipped with the reason it was not detected. It returns an error matching
+// ErrTrustNotFound if the name is not registered and there is no plugin with
+// the name.
+func WithLookup(name string) (Option, error) {
+	t, err := lookupTrust(name)
+	if err != nil {
+		return nil, err
+	}
+	return WithTrust(t), nil
+}
+
+// lookupTrust is like Lookup, but if the trust is registered and not present
+// it returns a failedTrust with the reason it was not detected.
+func lookupTrust(name string) (Trust, error) {
+	t, err := Lookup(name)
+	if err != nil && isRegistered(name) {
+		return &failedTrust{name: name, err: err}, nil
+	}
+	return t, err
+}
+
+// Registered returns the sorted names of the registered trusts.
+func Registered() []string {
+	detectorsMu.RLock()
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	detectorsMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+func isRegistered(name string) bool {
+	detectorsMu.RLock()
+	_, ok := detectors[name]
+	detectorsMu.RUnlock()
+	return ok
+}
+
+// Available runs the detectors of the registered trusts and returns the
+// detections sorted by name. The trusts present have Trust and Reason set,
+// the others have Err set. The plugins are not included, they must be
+// selected by name.
+func Available() []Detection {
+	names := Registered()
+	fns := make([]Detector, len(names))
+	detectorsMu.RLock()
+	for i, name := range names {
+		fns[i] = detectors[name]
+	}
+	detectorsMu.RUnlock()
+
+	detections := make([]Detection, len(names))
+	for i, name := range names {
+		t, reason, err := fns[i]()
+		detections[i] = Detection{Name: name, Reason: reason, Err: err}
+		if err == nil {
+			detections[i].Trust = t
+		}
+	}
+	return detections
+}
+
+// detected returns the trust if its PreCheck passes.
+func detected(t Trust, reason string) (Trust, string, error) {
+	if err := t.PreCheck(); err != nil {
+		return nil, "", err
+	}
+	return t, reason, nil
+}
+
+// notDetected returns the reason of a constructor error, the cause of
+// ErrTrustNotFound or the platform if the trust is not supported.
+func notDetected(err error) (Trust, string, error) {
+	if err == ErrTrustNotSupported {
+		return nil, "", fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+	return nil, "", err
+}
+
+func init() {
+	Register("chrome", func() (Trust, string, error) {
+		t, err := NewChromePolicyTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "managed policies in "+strings.Join(t.dirs, ", "))
+	})
+	Register("dotnet", func() (Trust, string, error) {
+		t, err := NewDotNetTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "dotnet found")
+	})
+	Register("firefox-policy", func() (Trust, string, error) {
+		t, err := NewFirefoxPolicyTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "policies in "+strings.Join(t.policyFiles, ", "))
+	})
+	Register("git", func() (Trust, string, error) {
+		t, err := NewGitTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "git found at "+t.gitPath)
+	})
+	Register("go", func() (Trust, string, error) {
+		t, err := NewGoTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "go found in PATH")
+	})
+	Register("java", func() (Trust, string, error) {
+		t, err := NewJavaTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "keytool found in JAVA_HOME "+filepath.Dir(filepath.Dir(t.keytoolPath)))
+	})
+	Register("node", func() (Trust, string, error) {
+		t, err := NewNodeTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "node found")
+	})
+	Register("nss", func() (Trust, string, error) {
+		t, err := NewNSSTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "certutil found at "+t.certutilPath)
+	})
+	Register("php", func() (Trust, string, error) {
+		t, err := NewPHPTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "php found in PATH")
+	})
+	Register("python", func() (Trust, string, error) {
+		t, err := NewPythonTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "certifi bundles "+strings.Join(t.bundles, ", "))
+	})
+	Register("python-env", func() (Trust, string, error) {
+		t, err := NewPythonEnvTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "python found")
+	})
+	Register("ruby", func() (Trust, string, error) {
+		t, err := NewRubyTrust()
+		if err != nil {
+			return notDetected(err)
+		}
+		return detected(t, "Ruby certificate files "+strings.Join(t.certFiles, ", "))
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/sha1" //nolint:gosec // used for the certificate thumbprint
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DotNetTrust implements a Trust for .NET on Linux. It installs the
+// certificate in the CurrentUser\Root store, a directory with a PKCS #12 file
+// per certificate named after its SHA-1 thumbprint.
+type DotNetTrust struct {
+	storeDir string
+}
+
+// NewDotNetTrust creates a new DotNetTrust if .NET is installed. It returns
+// ErrTrustNotSupported on platforms where .NET uses the platform truststore.
+func NewDotNetTrust() (*DotNetTrust, error) {
+	switch runtime.GOOS {
+	case "darwin", "windows", "ios":
+		return nil, ErrTrustNotSupported
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("dotnet"); err != nil {
+		if _, err := os.Stat(filepath.Join(home, ".dotnet", "dotnet")); err != nil {
+			return nil, trustNotFound("dotnet not found in PATH or in ~/.dotnet")
+		}
+	}
+	return &DotNetTrust{
+		storeDir: filepath.Join(home, ".dotnet", "corefx", "cryptography", "x509stores", "root"),
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *DotNetTrust) Name() string {
+	return "dotnet"
+}
+
+// Install implements the Trust interface.
+func (t *DotNetTrust) Install(_ string, cert *x509.Certificate) error {
+	data, err := encodePKCS12Certificate(cert)
+	if err != nil {
+		return err
+	}
+	// .NET requires the store to be only accessible by the user.
+	if err := os.MkdirAll(t.storeDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(t.filename(cert), data, 0600); err != nil {
+		return wrapError(err, "failed to write "+t.filename(cert))
+	}
+
+	debug("certificate installed properly in .NET root store")
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *DotNetTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	if err := os.Remove(t.filename(cert)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	debug("certificate uninstalled properly from .NET root store")
+	return nil
+}
+
+// Exists implements the Trust interface.
+func (t *DotNetTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	_, err := os.Stat(t.filename(cert))
+	return err == nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *DotNetTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf(`warning: "dotnet" is not available, install .NET to use the .NET trust`)
+}
+
+// paths implements the pathTrust interface.
+func (t *DotNetTrust) paths(cert *x509.Certificate) []string {
+	return []string{t.filename(cert)}
+}
+
+func (t *DotNetTrust) filename(cert *x509.Certificate) string {
+	//nolint:gosec // used for the certificate thumbprint
+	sum := sha1.Sum(cert.Raw)
+	return filepath.Join(t.storeDir, strings.ToUpper(hex.EncodeToString(sum[:]))+".pfx")
+}
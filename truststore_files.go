@@ -0,0 +1,154 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// writeFileAsRoot writes the data to the given file, creating the parent
+// directories if necessary. If the file cannot be written because of the file
+// permissions, it re-executes the operations wrapped in 'sudo'.
+func writeFileAsRoot(filename string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err == nil {
+		err = os.WriteFile(filename, data, perm)
+	}
+	if !useSudo(err) {
+		return err
+	}
+
+	cmd := exec.Command("sudo", "--", "mkdir", "-p", filepath.Dir(filename))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	//nolint:gosec // tolerable risk necessary for function
+	cmd = exec.Command("sudo", "--", "tee", filename)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	//nolint:gosec // tolerable risk necessary for function
+	cmd = exec.Command("sudo", "--", "chmod", fmt.Sprintf("%o", perm.Perm()), filename)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+// removeFileAsRoot removes the given file or empty directory, if it cannot be
+// removed because of the file permissions, it re-executes the operation
+// wrapped in 'sudo'. It does not fail if the file does not exist.
+func removeFileAsRoot(filename string) error {
+	err := os.Remove(filename)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	if !useSudo(err) {
+		return err
+	}
+
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command("sudo", "--", "rm", "-f", "-d", filename)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+// symlinkAsRoot creates newname as a symbolic link to oldname, if it cannot
+// be created because of the file permissions, it re-executes the operation
+// wrapped in 'sudo'.
+func symlinkAsRoot(oldname, newname string) error {
+	err := os.Symlink(oldname, newname)
+	if !useSudo(err) {
+		return err
+	}
+
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command("sudo", "--", "ln", "-s", oldname, newname)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+// renameAsRoot renames oldpath to newpath, if it cannot be renamed because of
+// the file permissions, it re-executes the operation wrapped in 'sudo'.
+func renameAsRoot(oldpath, newpath string) error {
+	err := os.Rename(oldpath, newpath)
+	if !useSudo(err) {
+		return err
+	}
+
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command("sudo", "--", "mv", "-f", oldpath, newpath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+func useSudo(err error) bool {
+	if err == nil || runtime.GOOS == "windows" || !errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	_, err = exec.LookPath("sudo")
+	return err == nil
+}
+
+// isWritable returns if the given file can be written or, if it does not
+// exist, created.
+func isWritable(filename string) bool {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return true
+	}
+	if !os.IsNotExist(err) {
+		return false
+	}
+	f, err = os.CreateTemp(filepath.Dir(filename), ".truststore")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// readJSONFile reads a JSON object from the given file. It returns an empty
+// object if the file does not exist.
+func readJSONFile(filename string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, wrapError(err, "error parsing "+filename)
+	}
+	return m, nil
+}
+
+// writeJSONFile writes the given object to a file using writeFileAsRoot.
+func writeJSONFile(filename string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAsRoot(filename, append(b, '\n'), 0644)
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	// FirefoxInstallDirs are the installation directories of Firefox on Linux,
+	// the policies are written in their distribution/policies.json.
+	FirefoxInstallDirs = []string{
+		"/usr/lib/firefox",
+		"/usr/lib64/firefox",
+		"/opt/firefox",
+	}
+
+	// FirefoxPoliciesDir is the system-wide directory of the Firefox
+	// policies on Linux.
+	FirefoxPoliciesDir = "/etc/firefox/policies"
+
+	// FirefoxCertificateDir is the directory where the certificates referenced
+	// by the Firefox policies are stored.
+	FirefoxCertificateDir = "/usr/local/share/truststore/firefox"
+)
+
+// FirefoxPolicyTrust implements a Trust for Firefox using the enterprise
+// policies. Unlike the NSS trust, it covers the profiles that do not exist
+// yet.
+type FirefoxPolicyTrust struct {
+	policyFiles []string
+}
+
+// NewFirefoxPolicyTrust creates a new FirefoxPolicyTrust if Firefox is
+// installed.
+func NewFirefoxPolicyTrust() (*FirefoxPolicyTrust, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrTrustNotSupported
+	}
+
+	var policyFiles []string
+	for _, dir := range FirefoxInstallDirs {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			policyFiles = append(policyFiles, filepath.Join(dir, "distribution", "policies.json"))
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(FirefoxPoliciesDir)); err == nil {
+		policyFiles = append(policyFiles, filepath.Join(FirefoxPoliciesDir, "policies.json"))
+	}
+	if len(policyFiles) == 0 {
+		return nil, trustNotFound("Firefox installation not found")
+	}
+
+	return &FirefoxPolicyTrust{
+		policyFiles: policyFiles,
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *FirefoxPolicyTrust) Name() string {
+	return "firefox-policy"
+}
+
+// Install implements the Trust interface. It stores the certificate in
+// FirefoxCertificateDir and adds it to Certificates.Install in the policies.
+// Certificates.ImportEnterpriseRoots is also enabled, so Firefox trusts the
+// certificates in the system truststore too.
+func (t *FirefoxPolicyTrust) Install(_ string, cert *x509.Certificate) error {
+	certFile := t.certFilename(cert)
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+	if err := writeFileAsRoot(certFile, data, 0644); err != nil {
+		return wrapError(err, "failed to write "+certFile)
+	}
+
+	for _, filename := range t.policyFiles {
+		_, err := os.Stat(filename)
+		created := os.IsNotExist(err)
+		root, err := readJSONFile(filename)
+		if err != nil {
+			return err
+		}
+		policies := jsonObject(root, "policies")
+		certificates := jsonObject(policies, "Certificates")
+		install := policyList(certificates["Install"])
+		importRoots := certificates["ImportEnterpriseRoots"] == true
+		if containsString(install, certFile) && importRoots {
+			continue
+		}
+		if !containsString(install, certFile) {
+			certificates["Install"] = append(install, certFile)
+		}
+		if !importRoots {
+			certificates["ImportEnterpriseRoots"] = true
+		}
+		if err := writeJSONFile(filename, root); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		if created {
+			if err := markPolicyFile(createdPoliciesFilename(), filename, true); err != nil {
+				return err
+			}
+		}
+		if !importRoots {
+			if err := markPolicyFile(enterpriseRootsFilename(), filename, true); err != nil {
+				return err
+			}
+		}
+		debug("certificate installed properly in %s", filename)
+	}
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *FirefoxPolicyTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	certFile := t.certFilename(cert)
+	for _, filename := range t.policyFiles {
+		root, err := readJSONFile(filename)
+		if err != nil {
+			return err
+		}
+		policies := jsonObject(root, "policies")
+		certificates := jsonObject(policies, "Certificates")
+		install := policyList(certificates["Install"])
+		if !containsString(install, certFile) {
+			continue
+		}
+
+		var keep []string
+		for _, s := range install {
+			if s != certFile {
+				keep = append(keep, s)
+			}
+		}
+		if len(keep) > 0 {
+			certificates["Install"] = keep
+		} else {
+			delete(certificates, "Install")
+		}
+		// ImportEnterpriseRoots is removed with the last certificate, only
+		// if truststore enabled it. Its default value is false.
+		unmark := !containsManagedFile(keep) && containsString(policyMarks(enterpriseRootsFilename()), filename)
+		if unmark {
+			delete(certificates, "ImportEnterpriseRoots")
+		}
+		if len(certificates) == 0 {
+			delete(policies, "Certificates")
+		}
+
+		// The policy file is only removed if truststore created it, otherwise
+		// the empty policies are kept.
+		remove := len(policies) == 0 && len(root) == 1 && containsString(policyMarks(createdPoliciesFilename()), filename)
+		if remove {
+			err = removeFileAsRoot(filename)
+		} else {
+			err = writeJSONFile(filename, root)
+		}
+		if err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		if remove {
+			if err := markPolicyFile(createdPoliciesFilename(), filename, false); err != nil {
+				return err
+			}
+		}
+		if unmark {
+			if err := markPolicyFile(enterpriseRootsFilename(), filename, false); err != nil {
+				return err
+			}
+		}
+		debug("certificate uninstalled properly from %s", filename)
+	}
+
+	if err := removeFileAsRoot(certFile); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// stored and referenced by all the policy files.
+func (t *FirefoxPolicyTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	certFile := t.certFilename(cert)
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return false
+	}
+	if block, _ := pem.Decode(b); block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		return false
+	}
+	for _, filename := range t.policyFiles {
+		root, err := readJSONFile(filename)
+		if err != nil {
+			return false
+		}
+		certificates := jsonObject(jsonObject(root, "policies"), "Certificates")
+		if !containsString(policyList(certificates["Install"]), certFile) {
+			return false
+		}
+		if certificates["ImportEnterpriseRoots"] != true {
+			return false
+		}
+	}
+	return true
+}
+
+// List implements the Lister interface. It returns the certificates stored in
+// FirefoxCertificateDir.
+func (t *FirefoxPolicyTrust) List() ([]Entry, error) {
+	return listCertificateFiles(filepath.Join(FirefoxCertificateDir, "*.crt")), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *FirefoxPolicyTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf("warning: Firefox is not available")
+}
+
+// paths implements the pathTrust interface.
+func (t *FirefoxPolicyTrust) paths(cert *x509.Certificate) []string {
+	return append([]string{t.certFilename(cert), enterpriseRootsFilename(), createdPoliciesFilename()}, t.policyFiles...)
+}
+
+func (t *FirefoxPolicyTrust) certFilename(cert *x509.Certificate) string {
+	return filepath.Join(FirefoxCertificateDir, strings.ReplaceAll(uniqueName(cert), " ", "_")+".crt")
+}
+
+// enterpriseRootsFilename returns the file with the policy files where
+// truststore enabled ImportEnterpriseRoots, one per line.
+func enterpriseRootsFilename() string {
+	return filepath.Join(FirefoxCertificateDir, "import-enterprise-roots")
+}
+
+// createdPoliciesFilename returns the file with the policy files created by
+// truststore, one per line.
+func createdPoliciesFilename() string {
+	return filepath.Join(FirefoxCertificateDir, "created-policies")
+}
+
+// policyMarks returns the policy files listed in the given marker file, see
+// enterpriseRootsFilename and createdPoliciesFilename.
+func policyMarks(marker string) []string {
+	b, err := os.ReadFile(marker)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(b))
+}
+
+// markPolicyFile adds or removes the policy file from the ones listed in the
+// given marker file.
+func markPolicyFile(marker, filename string, mark bool) error {
+	var files []string
+	for _, f := range policyMarks(marker) {
+		if f != filename {
+			files = append(files, f)
+		}
+	}
+	if mark {
+		files = append(files, filename)
+	}
+	if len(files) == 0 {
+		return removeFileAsRoot(marker)
+	}
+	if err := writeFileAsRoot(marker, []byte(strings.Join(files, "\n")+"\n"), 0644); err != nil {
+		return wrapError(err, "failed to write "+marker)
+	}
+	return nil
+}
+
+// containsManagedFile returns if any of the files is in
+// FirefoxCertificateDir.
+func containsManagedFile(files []string) bool {
+	for _, f := range files {
+		if filepath.Dir(f) == filepath.Clean(FirefoxCertificateDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonObject returns the object with the given key, it is created if it does
+// not exist.
+func jsonObject(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	v := make(map[string]interface{})
+	m[key] = v
+	return v
+}
@@ -22,6 +22,13 @@ var (
 
 	// SystemTrustCommand is the command used to update the system truststore.
 	SystemTrustCommand []string
+
+	// SystemBundleFiles are the possible locations of the system CA bundle.
+	SystemBundleFiles = []string{
+		"/usr/local/etc/ssl/cert.pem",
+		"/etc/ssl/cert.pem",
+		"/usr/local/share/certs/ca-root-nss.crt",
+	}
 )
 
 func init() {
@@ -94,6 +101,44 @@ func uninstallPlatform(filename string, cert *x509.Certificate) error {
 	return nil
 }
 
+// verifyPlatform checks that the certificate is linked by "certctl rehash" in
+// /etc/ssl/certs.
+func verifyPlatform(cert *x509.Certificate) error {
+	t := &CAPathTrust{dir: "/etc/ssl/certs"}
+	if !t.Exists(cert) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// refreshPlatform runs the SystemTrustCommand to regenerate the system CA
+// bundles.
+func refreshPlatform() error {
+	if SystemTrustCommand == nil {
+		return ErrNotSupported
+	}
+	cmd := CommandWithSudo(SystemTrustCommand...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+// systemPaths returns the files used to install the certificate in the system
+// truststore.
+func systemPaths(cert *x509.Certificate) []string {
+	return []string{systemTrustFilename(cert)}
+}
+
+// listPlatform returns the certificates in the directory of the root
+// certificates.
+func listPlatform() ([]Entry, error) {
+	if SystemTrustCommand == nil {
+		return nil, ErrNotSupported
+	}
+	return listCertificateFiles(fmt.Sprintf(SystemTrustFilename, "*")), nil
+}
+
 func CommandWithSudo(cmd ...string) *exec.Cmd {
 	if _, err := exec.LookPath("sudo"); err != nil {
 		return exec.Command(cmd[0], cmd[1:]...)
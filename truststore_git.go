@@ -0,0 +1,215 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// GitTrust implements a Trust for Git. It maintains a bundle with the system
+// roots and the installed certificates, and points http.sslCAInfo, or
+// http.<url>.sslCAInfo, in the global gitconfig to it.
+type GitTrust struct {
+	gitPath string
+	urls    []string
+	bundle  *caBundle
+}
+
+// NewGitTrust creates a new GitTrust if git is installed. If urls are given
+// the bundle is only configured for those URLs.
+func NewGitTrust(urls ...string) (*GitTrust, error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return nil, trustNotFound("git not found in PATH")
+	}
+	return &GitTrust{
+		gitPath: gitPath,
+		urls:    urls,
+		bundle: &caBundle{
+			path:        filepath.Join(userDataDir(), "git-ca-bundle.pem"),
+			systemRoots: true,
+		},
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *GitTrust) Name() string {
+	return "git"
+}
+
+// Install implements the Trust interface. A previous value of the sslCAInfo
+// keys is kept and restored on Uninstall.
+func (t *GitTrust) Install(_ string, cert *x509.Certificate) error {
+	if err := t.bundle.add(cert); err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+
+	for _, key := range t.keys() {
+		value, err := t.get(key)
+		if err != nil {
+			return err
+		}
+		if value == t.bundle.path {
+			continue
+		}
+		if value != "" {
+			if err := t.set(previousKey(key), value); err != nil {
+				return err
+			}
+		}
+		if err := t.set(key, t.bundle.path); err != nil {
+			return err
+		}
+	}
+
+	debug("certificate installed properly in git configuration")
+	return nil
+}
+
+// Uninstall implements the Trust interface. The git configuration is reverted
+// once there are no certificates left in the bundle.
+func (t *GitTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	empty, err := t.bundle.remove(cert)
+	if err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+	if !empty {
+		debug("certificate uninstalled properly from git configuration")
+		return nil
+	}
+
+	for _, key := range t.keys() {
+		value, err := t.get(key)
+		if err != nil {
+			return err
+		}
+		if value != t.bundle.path {
+			continue
+		}
+		previous, err := t.get(previousKey(key))
+		if err != nil {
+			return err
+		}
+		if previous == "" {
+			err = t.unset(key)
+		} else if err = t.set(key, previous); err == nil {
+			err = t.unset(previousKey(key))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	debug("certificate uninstalled properly from git configuration")
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in the bundle and the git configuration uses it.
+func (t *GitTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil || !t.bundle.contains(cert) {
+		return false
+	}
+	for _, key := range t.keys() {
+		if value, err := t.get(key); err != nil || value != t.bundle.path {
+			return false
+		}
+	}
+	return true
+}
+
+// List implements the Lister interface.
+func (t *GitTrust) List() ([]Entry, error) {
+	return t.bundle.entries(), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *GitTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf(`warning: "git" is not available, install git to use the git trust`)
+}
+
+// paths implements the pathTrust interface.
+func (t *GitTrust) paths(_ *x509.Certificate) []string {
+	return []string{t.bundle.path, gitGlobalConfig()}
+}
+
+// gitGlobalConfig returns the file modified by "git config --global",
+// GIT_CONFIG_GLOBAL, ~/.gitconfig or, if it does not exist and the XDG one
+// does, $XDG_CONFIG_HOME/git/config.
+func gitGlobalConfig() string {
+	if filename := os.Getenv("GIT_CONFIG_GLOBAL"); filename != "" {
+		return filename
+	}
+	home, _ := os.UserHomeDir()
+	filename := filepath.Join(home, ".gitconfig")
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		xdg := filepath.Join(configHome, "git", "config")
+		if _, err := os.Stat(xdg); err == nil {
+			return xdg
+		}
+	}
+	return filename
+}
+
+func (t *GitTrust) keys() []string {
+	if len(t.urls) == 0 {
+		return []string{"http.sslCAInfo"}
+	}
+	keys := make([]string, len(t.urls))
+	for i, u := range t.urls {
+		keys[i] = "http." + u + ".sslCAInfo"
+	}
+	return keys
+}
+
+// previousKey returns the key used to keep the previous value of the given
+// key, e.g. truststore.http.sslCAInfo.previous.
+func previousKey(key string) string {
+	return "truststore." + key + ".previous"
+}
+
+func (t *GitTrust) get(key string) (string, error) {
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(t.gitPath, "config", "--global", "--get", key)
+	out, err := cmd.Output()
+	if err != nil {
+		// git config exits with 1 if the key is not set
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", NewCmdError(err, cmd, out)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+func (t *GitTrust) set(key, value string) error {
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(t.gitPath, "config", "--global", key, value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+func (t *GitTrust) unset(key string) error {
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(t.gitPath, "config", "--global", "--unset", key)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// GoCertDirs are the system certificate directories used by Go programs. They
+// are kept in SSL_CERT_DIR, as setting it overrides the default ones.
+var GoCertDirs = []string{
+	"/etc/ssl/certs",
+	"/etc/pki/tls/certs",
+}
+
+// GoTrust implements a Trust for Go programs. It keeps the certificates in a
+// per-user directory and exports SSL_CERT_DIR with the system certificate
+// directories and this one.
+type GoTrust struct {
+	dir string
+}
+
+// NewGoTrust creates a new GoTrust if Go is installed. It returns
+// ErrTrustNotSupported on platforms where Go uses the platform verifier.
+func NewGoTrust() (*GoTrust, error) {
+	switch runtime.GOOS {
+	case "darwin", "windows", "ios":
+		return nil, ErrTrustNotSupported
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil, trustNotFound("go not found in PATH")
+	}
+	return &GoTrust{
+		dir: filepath.Join(userDataDir(), "go-certs"),
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *GoTrust) Name() string {
+	return "go"
+}
+
+// Install implements the Trust interface.
+func (t *GoTrust) Install(_ string, cert *x509.Certificate) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	filename := t.filename(cert)
+	if err := SaveCertificate(filename, cert); err != nil {
+		return wrapError(err, "failed to write "+filename)
+	}
+
+	dirs := []string{}
+	for _, dir := range GoCertDirs {
+		if _, err := os.Stat(dir); err == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	if err := writeEnvSnippet(t.Name(), []envVar{
+		{"SSL_CERT_DIR", strings.Join(append(dirs, t.dir), string(os.PathListSeparator))},
+	}); err != nil {
+		return err
+	}
+
+	debug("certificate installed properly in %s", filename)
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *GoTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	filename := t.filename(cert)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if entries, err := os.ReadDir(t.dir); err == nil && len(entries) == 0 {
+		if err := removeEnvSnippet(t.Name()); err != nil {
+			return err
+		}
+		os.Remove(t.dir)
+	}
+
+	debug("certificate uninstalled properly from %s", filename)
+	return nil
+}
+
+// Exists implements the Trust interface.
+func (t *GoTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	b, err := os.ReadFile(t.filename(cert))
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(b)
+	return block != nil && bytes.Equal(block.Bytes, cert.Raw)
+}
+
+// List implements the Lister interface.
+func (t *GoTrust) List() ([]Entry, error) {
+	return listCertificateFiles(filepath.Join(t.dir, "*.pem")), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *GoTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf(`warning: "go" is not available, install Go to use the Go trust`)
+}
+
+// paths implements the pathTrust interface.
+func (t *GoTrust) paths(cert *x509.Certificate) []string {
+	return append([]string{t.filename(cert)}, envSnippetPaths(t.Name())...)
+}
+
+func (t *GoTrust) filename(cert *x509.Certificate) string {
+	return filepath.Join(t.dir, strings.ReplaceAll(uniqueName(cert), " ", "_")+".pem")
+}
@@ -0,0 +1,1024 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// imageDistro describes where a Linux distribution keeps the CA anchors and
+// the bundle generated from them.
+type imageDistro struct {
+	ids    []string
+	anchor string
+	bundle string
+}
+
+// imageDistros are the distributions supported by InjectImage, they are
+// matched using the ID and ID_LIKE fields of the os-release file.
+var imageDistros = []imageDistro{
+	{
+		ids:    []string{"debian", "ubuntu", "alpine", "wolfi"},
+		anchor: "/usr/local/share/ca-certificates/%s.crt",
+		bundle: "/etc/ssl/certs/ca-certificates.crt",
+	},
+	{
+		ids:    []string{"fedora", "rhel", "centos", "amzn"},
+		anchor: "/etc/pki/ca-trust/source/anchors/%s.pem",
+		bundle: "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	},
+	{
+		ids:    []string{"suse", "opensuse", "sles"},
+		anchor: "/etc/pki/trust/anchors/%s.pem",
+		bundle: "/var/lib/ca-certificates/ca-bundle.pem",
+	},
+	{
+		ids:    []string{"arch"},
+		anchor: "/etc/ca-certificates/trust-source/anchors/%s.crt",
+		bundle: "/etc/ca-certificates/extracted/tls-ca-bundle.pem",
+	},
+}
+
+var osReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+const (
+	ociImageIndex         = "application/vnd.oci.image.index.v1+json"
+	ociLayer              = "application/vnd.oci.image.layer.v1.tar"
+	ociLayerGzip          = "application/vnd.oci.image.layer.v1.tar+gzip"
+	dockerManifest        = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestList    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerLayerGzip       = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	imageLayerDescription = "truststore image"
+
+	attestationReferenceType   = "vnd.docker.reference.type"
+	attestationReferenceDigest = "vnd.docker.reference.digest"
+	attestationManifest        = "attestation-manifest"
+)
+
+// InjectImage adds the given certificates to the container image in src and
+// writes the new image to dst. The image can be an OCI image layout, as a
+// directory or a tarball, or a tarball created with "docker save".
+//
+// The distribution of each image is detected from its os-release file, and a
+// new layer is appended with the certificates in the directory of the CA
+// anchors and a copy of the CA bundle including them. It does not require a
+// container runtime.
+func InjectImage(src, dst string, certs ...*x509.Certificate) error {
+	if len(certs) == 0 {
+		return ErrNotFound
+	}
+	if src == "" || dst == "" {
+		return fmt.Errorf("image source and destination are required")
+	}
+
+	l, err := openImageLayout(src)
+	if err != nil {
+		return err
+	}
+	if !l.isDir && sameFile(src, dst) {
+		return fmt.Errorf("image destination cannot be the same as the source")
+	}
+
+	switch {
+	case l.exists("index.json"):
+		if err := l.injectIndex(certs); err != nil {
+			return err
+		}
+	case l.exists("manifest.json"):
+		if err := l.injectDockerManifest(certs); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s is not an OCI image layout or a docker save archive", src)
+	}
+
+	if err := l.save(dst); err != nil {
+		return wrapError(err, "failed to write "+dst)
+	}
+	debug("certificates injected properly in %s", dst)
+	return nil
+}
+
+// imageLayout is an OCI image layout or a docker save archive. The new files
+// are kept in memory until the layout is saved.
+type imageLayout struct {
+	path  string
+	isDir bool
+	files map[string][]byte
+	// configs maps the paths of the original configs to the new configs
+	// and layers, it is used to update the manifest.json of docker save
+	// archives that are also OCI image layouts.
+	configs map[string]injectedConfig
+	// entries are the regular files of a tarball, indexed once by name.
+	entries map[string]tarEntry
+}
+
+// tarEntry is the position of the data of a file in a tarball.
+type tarEntry struct {
+	offset int64
+	size   int64
+}
+
+type injectedConfig struct {
+	config string
+	layer  string
+}
+
+func openImageLayout(filename string) (*imageLayout, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &imageLayout{
+		path:    filename,
+		isDir:   fi.IsDir(),
+		files:   make(map[string][]byte),
+		configs: make(map[string]injectedConfig),
+	}, nil
+}
+
+// open opens a file in the layout.
+func (l *imageLayout) open(name string) (io.ReadCloser, error) {
+	name = cleanImagePath(name)
+	if b, ok := l.files[name]; ok {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	if l.isDir {
+		return os.Open(filepath.Join(l.path, filepath.FromSlash(name)))
+	}
+
+	if l.entries == nil {
+		entries, err := indexTar(l.path)
+		if err != nil {
+			return nil, err
+		}
+		l.entries = entries
+	}
+	e, ok := l.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in %s", name, l.path)
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, e.offset, e.size), f}, nil
+}
+
+// indexTar returns the position of the regular files in a tarball.
+func indexTar(filename string) (map[string]tarEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The tar reader does not read ahead, the data of an entry starts at the
+	// position of the file after reading its header.
+	entries := make(map[string]tarEntry)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		entries[cleanImagePath(hdr.Name)] = tarEntry{offset: offset, size: hdr.Size}
+	}
+}
+
+func (l *imageLayout) exists(name string) bool {
+	rc, err := l.open(name)
+	if err != nil {
+		return false
+	}
+	rc.Close()
+	return true
+}
+
+func (l *imageLayout) readJSON(name string, v interface{}) error {
+	rc, err := l.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dec := json.NewDecoder(rc)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return wrapError(err, "error parsing "+name)
+	}
+	return nil
+}
+
+func (l *imageLayout) writeJSON(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.files[cleanImagePath(name)] = b
+	return nil
+}
+
+// writeBlob adds a blob to the layout and returns its digest.
+func (l *imageLayout) writeBlob(b []byte) string {
+	digest := digestOf(b)
+	l.files[blobPath(digest)] = b
+	return digest
+}
+
+func (l *imageLayout) writeJSONBlob(v interface{}) (string, int, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", 0, err
+	}
+	return l.writeBlob(b), len(b), nil
+}
+
+// injectIndex injects the certificates in all the Linux images referenced by
+// the index.json of an OCI image layout.
+func (l *imageLayout) injectIndex(certs []*x509.Certificate) error {
+	var index map[string]interface{}
+	if err := l.readJSON("index.json", &index); err != nil {
+		return err
+	}
+	n, err := l.injectManifests(index, certs)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s does not contain Linux images", l.path)
+	}
+	if err := l.writeJSON("index.json", index); err != nil {
+		return err
+	}
+
+	// docker save also writes a manifest.json with the paths of the blobs.
+	if l.exists("manifest.json") {
+		var manifest []map[string]interface{}
+		if err := l.readJSON("manifest.json", &manifest); err != nil {
+			return err
+		}
+		for _, m := range manifest {
+			config, _ := m["Config"].(string)
+			if c, ok := l.configs[cleanImagePath(config)]; ok {
+				m["Config"] = c.config
+				m["Layers"] = append(jsonList(m["Layers"]), c.layer)
+			}
+		}
+		if err := l.writeJSON("manifest.json", manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// injectManifests injects the certificates in the manifests of an index and
+// updates their descriptors. It returns the number of images modified.
+func (l *imageLayout) injectManifests(index map[string]interface{}, certs []*x509.Certificate) (int, error) {
+	var count int
+	injected := make(map[string]bool)
+	for _, v := range jsonList(index["manifests"]) {
+		desc, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Skip images for other operating systems and attestations.
+		if platform, ok := desc["platform"].(map[string]interface{}); ok {
+			if goos, _ := platform["os"].(string); goos != "" && goos != "linux" {
+				continue
+			}
+		}
+
+		digest, _ := desc["digest"].(string)
+		var manifest map[string]interface{}
+		if err := l.readJSON(blobPath(digest), &manifest); err != nil {
+			return 0, err
+		}
+		mediaType, _ := desc["mediaType"].(string)
+		if mediaType == "" {
+			mediaType, _ = manifest["mediaType"].(string)
+		}
+
+		var n int
+		switch {
+		case mediaType == ociImageIndex || mediaType == dockerManifestList || manifest["manifests"] != nil:
+			var err error
+			if n, err = l.injectManifests(manifest, certs); err != nil {
+				return 0, err
+			}
+		case manifest["layers"] != nil:
+			if err := l.injectManifest(manifest, mediaType, certs); err != nil {
+				return 0, err
+			}
+			n = 1
+		}
+		if n == 0 {
+			continue
+		}
+
+		newDigest, size, err := l.writeJSONBlob(manifest)
+		if err != nil {
+			return 0, err
+		}
+		injected[digest] = true
+		desc["digest"] = newDigest
+		desc["size"] = size
+		count += n
+	}
+
+	// The attestations of the images modified, e.g. the provenance or the
+	// SBOM added by BuildKit, describe the original images, they are removed.
+	var manifests []interface{}
+	for _, v := range jsonList(index["manifests"]) {
+		if desc, ok := v.(map[string]interface{}); ok {
+			annotations, _ := desc["annotations"].(map[string]interface{})
+			ref, _ := annotations[attestationReferenceDigest].(string)
+			if annotations[attestationReferenceType] == attestationManifest && injected[ref] {
+				debug("removing attestation manifest %s", desc["digest"])
+				continue
+			}
+		}
+		manifests = append(manifests, v)
+	}
+	if index["manifests"] != nil {
+		index["manifests"] = manifests
+	}
+	return count, nil
+}
+
+// injectManifest appends the certificates layer to an image manifest.
+func (l *imageLayout) injectManifest(manifest map[string]interface{}, mediaType string, certs []*x509.Certificate) error {
+	var layers []string
+	var compressed bool
+	for _, v := range jsonList(manifest["layers"]) {
+		desc, _ := v.(map[string]interface{})
+		digest, _ := desc["digest"].(string)
+		layerType, _ := desc["mediaType"].(string)
+		layers = append(layers, blobPath(digest))
+		compressed = strings.HasSuffix(layerType, "gzip")
+	}
+
+	layer, err := l.certificateLayer(layers, certs)
+	if err != nil {
+		return err
+	}
+	diffID := digestOf(layer)
+	layerType := ociLayer
+	switch {
+	case mediaType == dockerManifest:
+		// Docker manifests only support gzip layers.
+		compressed, layerType = true, dockerLayerGzip
+	case compressed:
+		layerType = ociLayerGzip
+	}
+	if compressed {
+		if layer, err = gzipData(layer); err != nil {
+			return err
+		}
+	}
+	layerDigest := l.writeBlob(layer)
+
+	configDesc, _ := manifest["config"].(map[string]interface{})
+	oldDigest, _ := configDesc["digest"].(string)
+	configDigest, configSize, err := l.injectConfig(blobPath(oldDigest), diffID, func(config map[string]interface{}) (string, int, error) {
+		return l.writeJSONBlob(config)
+	})
+	if err != nil {
+		return err
+	}
+	l.configs[blobPath(oldDigest)] = injectedConfig{
+		config: blobPath(configDigest),
+		layer:  blobPath(layerDigest),
+	}
+	configDesc["digest"] = configDigest
+	configDesc["size"] = configSize
+
+	manifest["layers"] = append(jsonList(manifest["layers"]), map[string]interface{}{
+		"mediaType": layerType,
+		"digest":    layerDigest,
+		"size":      len(layer),
+	})
+	return nil
+}
+
+// injectDockerManifest injects the certificates in all the images of the
+// manifest.json of a docker save archive.
+func (l *imageLayout) injectDockerManifest(certs []*x509.Certificate) error {
+	var manifest []map[string]interface{}
+	if err := l.readJSON("manifest.json", &manifest); err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		return fmt.Errorf("%s does not contain images", l.path)
+	}
+
+	for _, m := range manifest {
+		config, _ := m["Config"].(string)
+		var layers []string
+		for _, v := range jsonList(m["Layers"]) {
+			if s, ok := v.(string); ok {
+				layers = append(layers, s)
+			}
+		}
+
+		layer, err := l.certificateLayer(layers, certs)
+		if err != nil {
+			return err
+		}
+		// Newer versions of docker save use the blobs of the OCI layout,
+		// the older ones use a directory per layer.
+		blobs := strings.HasPrefix(cleanImagePath(config), "blobs/")
+		diffID := digestOf(layer)
+		layerPath := strings.TrimPrefix(diffID, "sha256:") + "/layer.tar"
+		if blobs {
+			layerPath = blobPath(diffID)
+		}
+		l.files[layerPath] = layer
+
+		newConfig, _, err := l.injectConfig(config, diffID, func(config map[string]interface{}) (string, int, error) {
+			b, err := json.Marshal(config)
+			if err != nil {
+				return "", 0, err
+			}
+			name := strings.TrimPrefix(digestOf(b), "sha256:") + ".json"
+			if blobs {
+				name = blobPath(digestOf(b))
+			}
+			l.files[name] = b
+			return name, len(b), nil
+		})
+		if err != nil {
+			return err
+		}
+		m["Config"] = newConfig
+		m["Layers"] = append(jsonList(m["Layers"]), layerPath)
+	}
+
+	return l.writeJSON("manifest.json", manifest)
+}
+
+// injectConfig adds the layer with the given diff id to an image config, the
+// new config is stored with the write function.
+func (l *imageLayout) injectConfig(name, diffID string, write func(map[string]interface{}) (string, int, error)) (string, int, error) {
+	var config map[string]interface{}
+	if err := l.readJSON(name, &config); err != nil {
+		return "", 0, err
+	}
+	rootfs, ok := config["rootfs"].(map[string]interface{})
+	if !ok {
+		rootfs = map[string]interface{}{"type": "layers"}
+		config["rootfs"] = rootfs
+	}
+	diffIDs := jsonList(rootfs["diff_ids"])
+	rootfs["diff_ids"] = append(diffIDs, diffID)
+	// The history has an entry for each layer, and entries marked as
+	// empty_layer. It is only extended if it matches the layers, a history
+	// that does not, e.g. a missing one, is left as it is.
+	history := jsonList(config["history"])
+	if historyLayers(history) == len(diffIDs) {
+		config["history"] = append(history, map[string]interface{}{
+			"created":    time.Now().UTC().Format(time.RFC3339),
+			"created_by": imageLayerDescription,
+			"comment":    "add CA certificates",
+		})
+	}
+	return write(config)
+}
+
+// historyLayers returns the number of entries in an image history that
+// created a layer.
+func historyLayers(history []interface{}) int {
+	var n int
+	for _, v := range history {
+		if h, ok := v.(map[string]interface{}); !ok || h["empty_layer"] != true {
+			n++
+		}
+	}
+	return n
+}
+
+// certificateLayer returns an uncompressed layer with the certificates for
+// the root filesystem of the given layers.
+func (l *imageLayout) certificateLayer(layers []string, certs []*x509.Certificate) ([]byte, error) {
+	fs := newImageFS()
+	for _, name := range layers {
+		if err := l.readLayer(fs, name); err != nil {
+			return nil, wrapError(err, "error reading layer "+name)
+		}
+	}
+
+	var osRelease []byte
+	for _, name := range osReleaseFiles {
+		if b, ok := fs.files[fs.resolve(name)]; ok {
+			osRelease = b
+			break
+		}
+	}
+	if osRelease == nil {
+		return nil, fmt.Errorf("os-release not found, the image distribution cannot be detected")
+	}
+	distro, err := detectImageDistro(osRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	// The paths are resolved so the layer does not replace a symbolic link
+	// with a file or a directory.
+	var names []string
+	files := make(map[string][]byte)
+	bundleFile := fs.resolve(distro.bundle)
+	bundle := fs.files[bundleFile]
+	for _, cert := range certs {
+		name := fs.resolve(fmt.Sprintf(distro.anchor, strings.ReplaceAll(uniqueName(cert), " ", "_")))
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+		}
+		files[name] = pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})
+		if !bundleContains(bundle, cert) {
+			bundle = appendBundleCertificate(bundle, cert)
+		}
+	}
+	names = append(names, bundleFile)
+	files[bundleFile] = bundle
+
+	// The parent directories are added before the files, as in the layers
+	// created by a build.
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for dir := path.Dir(name); dir != "/" && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	tw := tar.NewWriter(&buf)
+	for _, dir := range dirs {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     strings.TrimPrefix(dir, "/") + "/",
+			Mode:     0755,
+			ModTime:  now,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(name, "/"),
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+			ModTime:  now,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readLayer applies a layer to the filesystem.
+func (l *imageLayout) readLayer(fs *imageFS, name string) error {
+	upper := newImageFS()
+	var replaced, whiteouts, opaques []string
+	hardlinks := make(map[string]string)
+	err := l.walkLayer(name, func(hdr *tar.Header, r io.Reader) error {
+		p := path.Clean("/" + hdr.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == ".wh..wh..opq":
+			opaques = append(opaques, path.Clean(dir))
+		case strings.HasPrefix(base, ".wh."):
+			whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, ".wh.")))
+		default:
+			replaced = append(replaced, p)
+			delete(upper.files, p)
+			delete(upper.links, p)
+			delete(hardlinks, p)
+			switch {
+			case hdr.Typeflag == tar.TypeSymlink:
+				upper.links[p] = hdr.Linkname
+			case hdr.Typeflag == tar.TypeLink && imageFileNames[base]:
+				hardlinks[p] = path.Clean("/" + hdr.Linkname)
+			case hdr.Typeflag == tar.TypeReg && imageFileNames[base]:
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				upper.files[p] = b
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The target of a hard link is an earlier entry of the same layer, it is
+	// only read if its name is not one of the files kept.
+	targets := make(map[string][]byte)
+	for _, target := range hardlinks {
+		if _, ok := upper.files[target]; !ok {
+			targets[target] = nil
+		}
+	}
+	if len(targets) > 0 {
+		err := l.walkLayer(name, func(hdr *tar.Header, r io.Reader) error {
+			p := path.Clean("/" + hdr.Name)
+			if _, ok := targets[p]; !ok || hdr.Typeflag != tar.TypeReg {
+				return nil
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			targets[p] = b
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for p, target := range hardlinks {
+		if b, ok := upper.files[target]; ok {
+			upper.files[p] = b
+		} else if b := targets[target]; b != nil {
+			upper.files[p] = b
+		} else if b, ok := fs.files[target]; ok {
+			upper.files[p] = b
+		}
+	}
+
+	for _, p := range opaques {
+		fs.remove(p, true)
+	}
+	for _, p := range whiteouts {
+		fs.remove(p, false)
+	}
+	for _, p := range replaced {
+		delete(fs.files, p)
+		delete(fs.links, p)
+	}
+	for p, b := range upper.files {
+		fs.files[p] = b
+	}
+	for p, link := range upper.links {
+		fs.links[p] = link
+	}
+	return nil
+}
+
+// walkLayer calls fn with each entry of a layer, compressed or not.
+func (l *imageLayout) walkLayer(name string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	rc, err := l.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return fmt.Errorf("zstd compressed layers are not supported")
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// imageFileNames are the base names of the files read from the layers.
+var imageFileNames = func() map[string]bool {
+	m := map[string]bool{}
+	for _, name := range osReleaseFiles {
+		m[path.Base(name)] = true
+	}
+	for _, d := range imageDistros {
+		m[path.Base(d.bundle)] = true
+	}
+	return m
+}()
+
+// imageFS keeps the files of an image root filesystem used to inject the
+// certificates, and all its symbolic links.
+type imageFS struct {
+	files map[string][]byte
+	links map[string]string
+}
+
+func newImageFS() *imageFS {
+	return &imageFS{
+		files: make(map[string][]byte),
+		links: make(map[string]string),
+	}
+}
+
+// remove removes the given path and its children. If onlyChildren is true
+// the path itself is kept.
+func (fs *imageFS) remove(p string, onlyChildren bool) {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for name := range fs.files {
+		if (!onlyChildren && name == p) || strings.HasPrefix(name, prefix) {
+			delete(fs.files, name)
+		}
+	}
+	for name := range fs.links {
+		if (!onlyChildren && name == p) || strings.HasPrefix(name, prefix) {
+			delete(fs.links, name)
+		}
+	}
+}
+
+// resolve returns the path after following the symbolic links.
+func (fs *imageFS) resolve(p string) string {
+	for hops := 0; hops < 40; hops++ {
+		parts := strings.Split(strings.TrimPrefix(path.Clean(p), "/"), "/")
+		resolved := true
+		for i := range parts {
+			cur := "/" + strings.Join(parts[:i+1], "/")
+			link, ok := fs.links[cur]
+			if !ok {
+				continue
+			}
+			if !path.IsAbs(link) {
+				link = path.Join(path.Dir(cur), link)
+			}
+			p = path.Join(append([]string{link}, parts[i+1:]...)...)
+			resolved = false
+			break
+		}
+		if resolved {
+			return path.Clean(p)
+		}
+	}
+	return path.Clean(p)
+}
+
+// detectImageDistro returns the distribution for the given os-release file.
+func detectImageDistro(osRelease []byte) (*imageDistro, error) {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(osRelease), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+
+	ids := append([]string{fields["ID"]}, strings.Fields(fields["ID_LIKE"])...)
+	for _, id := range ids {
+		for i := range imageDistros {
+			if containsString(imageDistros[i].ids, id) {
+				return &imageDistros[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("distribution %q is not supported", fields["ID"])
+}
+
+// save writes the layout with the new files to dst.
+func (l *imageLayout) save(dst string) error {
+	names := make([]string, 0, len(l.files))
+	for name := range l.files {
+		names = append(names, name)
+	}
+	// Write the blobs before the files referencing them.
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := isImageRoot(names[i]), isImageRoot(names[j])
+		if ri != rj {
+			return rj
+		}
+		return names[i] < names[j]
+	})
+
+	if l.isDir {
+		return l.saveDir(dst, names)
+	}
+	return l.saveTar(dst, names)
+}
+
+func (l *imageLayout) saveDir(dst string, names []string) error {
+	if !sameFile(l.path, dst) {
+		err := filepath.Walk(l.path, func(filename string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(l.path, filename)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, rel)
+			switch {
+			case fi.IsDir():
+				return os.MkdirAll(target, 0755)
+			case !fi.Mode().IsRegular():
+				return nil
+			}
+			if _, ok := l.files[filepath.ToSlash(rel)]; ok {
+				return nil
+			}
+			return copyFile(filename, target, fi.Mode().Perm())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		filename := filepath.Join(dst, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, l.files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *imageLayout) saveTar(dst string, names []string) error {
+	src, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := os.CreateTemp(filepath.Dir(dst), ".truststore-image-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := l.files[cleanImagePath(hdr.Name)]; ok {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil { //nolint:gosec // the sizes are in the headers
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(l.files[name])),
+			ModTime:  now,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(l.files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+// isImageRoot returns if the name is one of the files that reference the
+// images.
+func isImageRoot(name string) bool {
+	return name == "index.json" || name == "manifest.json"
+}
+
+// digestOf returns the SHA-256 digest of the given data.
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func cleanImagePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// blobPath returns the path of a blob in an OCI image layout.
+func blobPath(digest string) string {
+	algorithm, hash, _ := strings.Cut(digest, ":")
+	return "blobs/" + algorithm + "/" + hash
+}
+
+func jsonList(v interface{}) []interface{} {
+	list, _ := v.([]interface{})
+	return list
+}
+
+func gzipData(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// sameFile returns if both paths refer to the same file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
@@ -0,0 +1,573 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTarEntry is an entry of a tarball created with testTar.
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	data     string
+	linkname string
+}
+
+func testTar(t *testing.T, entries ...testTarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		hdr := &tar.Header{
+			Typeflag: typeflag,
+			Name:     e.name,
+			Linkname: e.linkname,
+			Mode:     0644,
+		}
+		if typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.data))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTestTar returns the entries of a tarball.
+func readTestTar(t *testing.T, b []byte) []testTarEntry {
+	t.Helper()
+	var entries []testTarEntry
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, testTarEntry{
+			name:     hdr.Name,
+			typeflag: hdr.Typeflag,
+			data:     string(data),
+			linkname: hdr.Linkname,
+		})
+	}
+}
+
+func testCertificate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1234),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestImageLayoutReadLayer(t *testing.T) {
+	const osRelease = "ID=debian\n"
+	const bundle = "/etc/ssl/certs/ca-certificates.crt"
+	tests := []struct {
+		name   string
+		layers [][]testTarEntry
+		files  map[string]string
+		links  map[string]string
+	}{
+		{
+			name: "regular files",
+			layers: [][]testTarEntry{{
+				{name: "etc/os-release", data: osRelease},
+				{name: "etc/ssl/certs/ca-certificates.crt", data: "bundle"},
+				{name: "etc/passwd", data: "root"},
+			}},
+			files: map[string]string{"/etc/os-release": osRelease, bundle: "bundle"},
+		},
+		{
+			name: "hard link to a file kept",
+			layers: [][]testTarEntry{{
+				{name: "usr/lib/os-release", data: osRelease},
+				{name: "etc/os-release", typeflag: tar.TypeLink, linkname: "usr/lib/os-release"},
+			}},
+			files: map[string]string{"/usr/lib/os-release": osRelease, "/etc/os-release": osRelease},
+		},
+		{
+			name: "hard link to another file",
+			layers: [][]testTarEntry{{
+				{name: "etc/ssl/cert.pem", data: "bundle"},
+				{name: "etc/ssl/certs/ca-certificates.crt", typeflag: tar.TypeLink, linkname: "etc/ssl/cert.pem"},
+			}},
+			files: map[string]string{bundle: "bundle"},
+		},
+		{
+			name: "hard link in a gzip layer",
+			layers: [][]testTarEntry{{
+				{name: "./etc/ssl/cert.pem", data: "gzip bundle"},
+				{name: "./etc/ssl/certs/ca-certificates.crt", typeflag: tar.TypeLink, linkname: "./etc/ssl/cert.pem"},
+			}},
+			files: map[string]string{bundle: "gzip bundle"},
+		},
+		{
+			name: "symbolic links",
+			layers: [][]testTarEntry{{
+				{name: "usr/lib/os-release", data: osRelease},
+				{name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "../usr/lib/os-release"},
+			}},
+			files: map[string]string{"/usr/lib/os-release": osRelease},
+			links: map[string]string{"/etc/os-release": "../usr/lib/os-release"},
+		},
+		{
+			name: "upper layer replaces a file",
+			layers: [][]testTarEntry{
+				{{name: "etc/ssl/certs/ca-certificates.crt", data: "old"}},
+				{{name: "etc/ssl/certs/ca-certificates.crt", data: "new"}},
+			},
+			files: map[string]string{bundle: "new"},
+		},
+		{
+			name: "whiteout",
+			layers: [][]testTarEntry{
+				{{name: "etc/os-release", data: osRelease}, {name: "etc/ssl/certs/ca-certificates.crt", data: "bundle"}},
+				{{name: "etc/ssl/certs/.wh.ca-certificates.crt"}},
+			},
+			files: map[string]string{"/etc/os-release": osRelease},
+		},
+		{
+			name: "opaque directory",
+			layers: [][]testTarEntry{
+				{{name: "etc/os-release", data: osRelease}, {name: "etc/ssl/certs/ca-certificates.crt", data: "old"}},
+				{{name: "etc/ssl/.wh..wh..opq"}, {name: "etc/ssl/certs/ca-bundle.pem", data: "bundle"}},
+			},
+			files: map[string]string{"/etc/os-release": osRelease, "/etc/ssl/certs/ca-bundle.pem": "bundle"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &imageLayout{files: make(map[string][]byte)}
+			fs := newImageFS()
+			for i, entries := range tt.layers {
+				b := testTar(t, entries...)
+				if strings.Contains(tt.name, "gzip") {
+					var err error
+					if b, err = gzipData(b); err != nil {
+						t.Fatal(err)
+					}
+				}
+				name := "layer" + string(rune('0'+i))
+				l.files[name] = b
+				if err := l.readLayer(fs, name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			files := make(map[string]string)
+			for p, b := range fs.files {
+				files[p] = string(b)
+			}
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("files = %v, want %v", files, tt.files)
+			}
+			links := tt.links
+			if links == nil {
+				links = map[string]string{}
+			}
+			if !reflect.DeepEqual(fs.links, links) {
+				t.Errorf("links = %v, want %v", fs.links, links)
+			}
+		})
+	}
+}
+
+func TestImageFSResolve(t *testing.T) {
+	fs := newImageFS()
+	fs.links["/etc/ssl/certs"] = "/etc/pki/tls/certs"
+	fs.links["/etc/pki/tls/certs/ca-certificates.crt"] = "ca-bundle.crt"
+	fs.links["/etc/os-release"] = "../usr/lib/os-release"
+	fs.links["/loop"] = "/loop"
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/etc/passwd", "/etc/passwd"},
+		{"/etc/os-release", "/usr/lib/os-release"},
+		{"/etc/ssl/certs/ca-certificates.crt", "/etc/pki/tls/certs/ca-bundle.crt"},
+		{"/etc/ssl/certs/other.pem", "/etc/pki/tls/certs/other.pem"},
+		{"/loop", "/loop"},
+	}
+	for _, tt := range tests {
+		if got := fs.resolve(tt.path); got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectImageDistro(t *testing.T) {
+	tests := []struct {
+		osRelease string
+		bundle    string
+		wantErr   bool
+	}{
+		{"ID=debian\n", "/etc/ssl/certs/ca-certificates.crt", false},
+		{"ID=\"alpine\"\n", "/etc/ssl/certs/ca-certificates.crt", false},
+		{"ID=rocky\nID_LIKE=\"rhel centos fedora\"\n", "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", false},
+		{"ID=opensuse-leap\nID_LIKE=\"suse opensuse\"\n", "/var/lib/ca-certificates/ca-bundle.pem", false},
+		{"# comment\nID=arch\n", "/etc/ca-certificates/extracted/tls-ca-bundle.pem", false},
+		{"ID=gentoo\n", "", true},
+	}
+	for _, tt := range tests {
+		d, err := detectImageDistro([]byte(tt.osRelease))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("detectImageDistro(%q) error = %v, wantErr %v", tt.osRelease, err, tt.wantErr)
+			continue
+		}
+		if err == nil && d.bundle != tt.bundle {
+			t.Errorf("detectImageDistro(%q) bundle = %q, want %q", tt.osRelease, d.bundle, tt.bundle)
+		}
+	}
+}
+
+func TestImageLayoutCertificateLayer(t *testing.T) {
+	cert := testCertificate(t, "Test Image CA")
+	tests := []struct {
+		name  string
+		layer []testTarEntry
+		want  []string
+	}{
+		{
+			name: "debian",
+			layer: []testTarEntry{
+				{name: "etc/os-release", data: "ID=debian\n"},
+				{name: "etc/ssl/certs/ca-certificates.crt", data: "system roots\n"},
+			},
+			want: []string{
+				"etc/", "etc/ssl/", "etc/ssl/certs/", "usr/", "usr/local/", "usr/local/share/",
+				"usr/local/share/ca-certificates/",
+				"usr/local/share/ca-certificates/Test_Image_CA_1234.crt",
+				"etc/ssl/certs/ca-certificates.crt",
+			},
+		},
+		{
+			name: "symbolic link to the bundle",
+			layer: []testTarEntry{
+				{name: "usr/lib/os-release", data: "ID=fedora\n"},
+				{name: "etc/pki/ca-trust/extracted/pem", typeflag: tar.TypeSymlink, linkname: "/usr/share/pki"},
+				{name: "usr/share/pki/tls-ca-bundle.pem", data: "system roots\n"},
+			},
+			want: []string{
+				"etc/", "etc/pki/", "etc/pki/ca-trust/", "etc/pki/ca-trust/source/",
+				"etc/pki/ca-trust/source/anchors/", "usr/", "usr/share/", "usr/share/pki/",
+				"etc/pki/ca-trust/source/anchors/Test_Image_CA_1234.pem",
+				"usr/share/pki/tls-ca-bundle.pem",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &imageLayout{files: map[string][]byte{"layer": testTar(t, tt.layer...)}}
+			b, err := l.certificateLayer([]string{"layer"}, []*x509.Certificate{cert})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			var bundle string
+			for _, e := range readTestTar(t, b) {
+				names = append(names, e.name)
+				if e.typeflag == tar.TypeDir && !strings.HasSuffix(e.name, "/") {
+					t.Errorf("directory %q without a trailing slash", e.name)
+				}
+				if strings.Contains(e.name, "bundle") || strings.HasSuffix(e.name, "ca-certificates.crt") {
+					bundle = e.data
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("entries = %q, want %q", names, tt.want)
+			}
+			if !strings.HasPrefix(bundle, "system roots\n") || !bundleContains([]byte(bundle), cert) {
+				t.Errorf("bundle does not contain the system roots and the certificate:\n%s", bundle)
+			}
+		})
+	}
+}
+
+func TestImageLayoutInjectIndexAttestations(t *testing.T) {
+	cert := testCertificate(t, "Test Image CA")
+	l := &imageLayout{files: make(map[string][]byte), configs: make(map[string]injectedConfig)}
+	writeJSON := func(v interface{}) string {
+		digest, _, err := l.writeJSONBlob(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	layer := l.writeBlob(testTar(t,
+		testTarEntry{name: "etc/os-release", data: "ID=alpine\n"},
+		testTarEntry{name: "etc/ssl/certs/ca-certificates.crt", data: "system roots\n"},
+	))
+	config := writeJSON(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{layer}},
+	})
+	image := writeJSON(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": config},
+		"layers":        []interface{}{map[string]interface{}{"mediaType": ociLayer, "digest": layer}},
+	})
+	attestation := func(ref string) map[string]interface{} {
+		return map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"digest":    writeJSON(map[string]interface{}{"layers": []interface{}{}, "ref": ref}),
+			"platform":  map[string]interface{}{"os": "unknown", "architecture": "unknown"},
+			"annotations": map[string]interface{}{
+				attestationReferenceType:   attestationManifest,
+				attestationReferenceDigest: ref,
+			},
+		}
+	}
+	other := "sha256:" + strings.Repeat("0", 64)
+	index := map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []interface{}{
+			map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest":    image,
+				"platform":  map[string]interface{}{"os": "linux", "architecture": "amd64"},
+			},
+			attestation(image),
+			attestation(other),
+		},
+	}
+	if err := l.writeJSON("index.json", index); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.injectIndex([]*x509.Certificate{cert}); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Manifests []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(l.files["index.json"], &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Manifests) != 2 {
+		t.Fatalf("index has %d manifests, want 2", len(got.Manifests))
+	}
+	if got.Manifests[0].Digest == image {
+		t.Errorf("image manifest digest was not updated")
+	}
+	if ref := got.Manifests[1].Annotations[attestationReferenceDigest]; ref != other {
+		t.Errorf("kept attestation references %s, want %s", ref, other)
+	}
+
+	var manifest struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := l.readJSON(blobPath(got.Manifests[0].Digest), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 2 {
+		t.Fatalf("manifest has %d layers, want 2", len(manifest.Layers))
+	}
+	if _, ok := l.files[blobPath(manifest.Layers[1].Digest)]; !ok {
+		t.Errorf("certificates layer %s not written", manifest.Layers[1].Digest)
+	}
+}
+
+func TestImageLayoutOpenTar(t *testing.T) {
+	entries := []testTarEntry{
+		{name: "oci-layout", data: `{"imageLayoutVersion":"1.0.0"}`},
+		{name: "blobs/", typeflag: tar.TypeDir},
+		{name: "blobs/sha256/", typeflag: tar.TypeDir},
+		{name: "blobs/sha256/aaaa", data: strings.Repeat("a", 1000)},
+		{name: "./blobs/sha256/bbbb", data: "b"},
+		{name: "index.json", data: `{"manifests":[]}`},
+	}
+	filename := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(filename, testTar(t, entries...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := openImageLayout(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read in a different order than the archive.
+	var names []string
+	for _, e := range entries {
+		if e.typeflag == 0 {
+			names = append(names, cleanImagePath(e.name))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	want := make(map[string]string)
+	for _, e := range entries {
+		want[cleanImagePath(e.name)] = e.data
+	}
+	for _, name := range names {
+		rc, err := l.open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want[name] {
+			t.Errorf("open(%q) = %q, want %q", name, b, want[name])
+		}
+	}
+	if len(l.entries) != len(names) {
+		t.Errorf("indexed %d entries, want %d", len(l.entries), len(names))
+	}
+	if l.exists("blobs/sha256") || l.exists("missing.json") {
+		t.Errorf("exists returned true for a directory or a missing file")
+	}
+}
+
+func TestInjectImageTarball(t *testing.T) {
+	cert := testCertificate(t, "Test Image CA")
+	l := &imageLayout{files: make(map[string][]byte)}
+	layer := l.writeBlob(testTar(t,
+		testTarEntry{name: "etc/os-release", data: "ID=debian\n"},
+		testTarEntry{name: "etc/ssl/certs/ca-certificates.crt", data: "system roots\n"},
+	))
+	config, _, err := l.writeJSONBlob(map[string]interface{}{
+		"rootfs":  map[string]interface{}{"type": "layers", "diff_ids": []string{layer}},
+		"history": []interface{}{map[string]interface{}{"created_by": "ADD rootfs"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, _, err := l.writeJSONBlob(map[string]interface{}{
+		"schemaVersion": 2,
+		"config":        map[string]interface{}{"digest": config},
+		"layers":        []interface{}{map[string]interface{}{"mediaType": ociLayer, "digest": layer}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []testTarEntry{{name: "oci-layout", data: `{"imageLayoutVersion":"1.0.0"}`}}
+	for name, b := range l.files {
+		entries = append(entries, testTarEntry{name: name, data: string(b)})
+	}
+	entries = append(entries, testTarEntry{
+		name: "index.json",
+		data: `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + image + `"}]}`,
+	})
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.tar"), filepath.Join(dir, "dst.tar")
+	if err := os.WriteFile(src, testTar(t, entries...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := InjectImage(src, dst, cert); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := openImageLayout(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := out.readJSON("index.json", &index); err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := out.readJSON(blobPath(index.Manifests[0].Digest), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 2 || manifest.Layers[0].Digest != layer {
+		t.Fatalf("layers = %v, want the original layer and the certificates", manifest.Layers)
+	}
+	var cfg struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+		History []interface{} `json:"history"`
+	}
+	if err := out.readJSON(blobPath(manifest.Config.Digest), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.RootFS.DiffIDs) != 2 || len(cfg.History) != 2 {
+		t.Errorf("config has %d diff ids and %d history entries, want 2", len(cfg.RootFS.DiffIDs), len(cfg.History))
+	}
+
+	fs := newImageFS()
+	for _, desc := range manifest.Layers {
+		if err := out.readLayer(fs, blobPath(desc.Digest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bundleContains(fs.files["/etc/ssl/certs/ca-certificates.crt"], cert) {
+		t.Error("the bundle of the new image does not contain the certificate")
+	}
+}
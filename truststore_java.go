@@ -25,13 +25,14 @@ var JavaStorePass = "changeit"
 type JavaTrust struct {
 	keytoolPath string
 	cacertsPath string
+	keystore    bool
 }
 
 // NewJavaTrust initializes a new JavaTrust if the environment has java installed.
 func NewJavaTrust() (*JavaTrust, error) {
 	home := os.Getenv("JAVA_HOME")
 	if home == "" {
-		return nil, ErrTrustNotFound
+		return nil, trustNotFound("JAVA_HOME is not set")
 	}
 
 	var keytoolPath, cacertsPath string
@@ -42,7 +43,10 @@ func NewJavaTrust() (*JavaTrust, error) {
 	}
 
 	if _, err := os.Stat(keytoolPath); err != nil {
-		return nil, ErrTrustNotFound
+		if os.IsNotExist(err) {
+			return nil, trustNotFound("%s not found, JAVA_HOME is not a JDK", keytoolPath)
+		}
+		return nil, err
 	}
 
 	_, err := os.Stat(filepath.Join(home, "lib", "security", "cacerts"))
@@ -61,8 +65,33 @@ func NewJavaTrust() (*JavaTrust, error) {
 	}, nil
 }
 
-// Name implement the Trust interface.
+// NewJavaKeystoreTrust creates a new JavaTrust for the given keystore. The
+// keytool command is searched in JAVA_HOME and in the PATH.
+func NewJavaKeystoreTrust(keystore string) (*JavaTrust, error) {
+	keytoolPath, err := exec.LookPath("keytool")
+	if t, err1 := NewJavaTrust(); err1 == nil {
+		keytoolPath, err = t.keytoolPath, nil
+	}
+	if err != nil {
+		return nil, trustNotFound("keytool not found in JAVA_HOME or in PATH")
+	}
+	if _, err := os.Stat(keystore); err != nil {
+		return nil, err
+	}
+
+	return &JavaTrust{
+		keytoolPath: keytoolPath,
+		cacertsPath: keystore,
+		keystore:    true,
+	}, nil
+}
+
+// Name implement the Trust interface. The name of the trusts created with
+// NewJavaKeystoreTrust includes the keystore path, e.g. "java:/path/cacerts".
 func (t *JavaTrust) Name() string {
+	if t != nil && t.keystore {
+		return "java:" + t.cacertsPath
+	}
 	return "java"
 }
 
@@ -141,6 +170,31 @@ func (t *JavaTrust) Exists(cert *x509.Certificate) bool {
 	return exists(cert, s1, keytoolOutput) || exists(cert, s256, keytoolOutput)
 }
 
+// List implements the Lister interface.
+func (t *JavaTrust) List() ([]Entry, error) {
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(t.keytoolPath, "-list", "-rfc", "-keystore", t.cacertsPath, "-storepass", JavaStorePass)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, NewCmdError(err, cmd, out)
+	}
+
+	// Each entry starts with "Alias name: <alias>" followed by the entry type
+	// and the certificates in PEM format. Only the trusted certificates are
+	// returned, not the chains of the private keys.
+	var entries []Entry
+	for _, s := range strings.Split(string(out), "Alias name: ")[1:] {
+		alias, rest, _ := strings.Cut(s, "\n")
+		if !strings.Contains(rest, "Entry type: trustedCertEntry") {
+			continue
+		}
+		for _, cert := range parseCertificates([]byte(rest)) {
+			entries = append(entries, Entry{Name: strings.TrimSpace(alias), Certificate: cert})
+		}
+	}
+	return entries, nil
+}
+
 // PreCheck implements the Trust interface.
 func (t *JavaTrust) PreCheck() error {
 	if t != nil {
@@ -149,6 +203,11 @@ func (t *JavaTrust) PreCheck() error {
 	return fmt.Errorf("define JAVA_HOME environment variable to use the Java trust")
 }
 
+// paths implements the pathTrust interface.
+func (t *JavaTrust) paths(cert *x509.Certificate) []string {
+	return []string{t.cacertsPath}
+}
+
 // execKeytool will execute a "keytool" command and if needed re-execute
 // the command wrapped in 'sudo' to work around file permissions.
 func execKeytool(cmd *exec.Cmd) ([]byte, error) {
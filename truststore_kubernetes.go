@@ -0,0 +1,218 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// KubernetesOption is the type used to pass custom options to
+// ExportKubernetes.
+type KubernetesOption func(*kubernetesOptions)
+
+type kubernetesOptions struct {
+	name         string
+	namespace    string
+	secret       bool
+	issuerKey    []byte
+	trustManager bool
+}
+
+// certManagerNamespace is the default namespace of cert-manager and
+// trust-manager. The ClusterIssuer secrets and the Bundle sources must be in
+// it.
+const certManagerNamespace = "cert-manager"
+
+// WithKubernetesName sets the name of the resources. By default it is derived
+// from the name used in the truststores.
+func WithKubernetesName(name string) KubernetesOption {
+	return func(o *kubernetesOptions) {
+		o.name = name
+	}
+}
+
+// WithKubernetesNamespace sets the namespace of the ConfigMap or Secret with
+// the bundle. It defaults to "default", or to "cert-manager" if a
+// trust-manager Bundle is rendered.
+func WithKubernetesNamespace(namespace string) KubernetesOption {
+	return func(o *kubernetesOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithKubernetesSecret renders the bundle in a Secret instead of a ConfigMap.
+func WithKubernetesSecret() KubernetesOption {
+	return func(o *kubernetesOptions) {
+		o.secret = true
+	}
+}
+
+// WithClusterIssuer renders a cert-manager CA ClusterIssuer and the
+// kubernetes.io/tls Secret it uses. The PEM-encoded key must be the key of
+// the first certificate.
+func WithClusterIssuer(keyPEM []byte) KubernetesOption {
+	return func(o *kubernetesOptions) {
+		o.issuerKey = keyPEM
+	}
+}
+
+// WithTrustManagerBundle renders a trust-manager Bundle that distributes the
+// bundle to all namespaces.
+func WithTrustManagerBundle() KubernetesOption {
+	return func(o *kubernetesOptions) {
+		o.trustManager = true
+	}
+}
+
+var kubernetesNameRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// kubernetesName converts the name used in the truststores to a valid
+// Kubernetes resource name.
+func kubernetesName(s string) string {
+	s = strings.Trim(kubernetesNameRegexp.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(s) > 253 {
+		s = strings.TrimRight(s[:253], "-")
+	}
+	return s
+}
+
+// kubernetesSuffixedName adds the suffix to a name returned by kubernetesName,
+// the name is truncated so the result is still a valid name with the suffix.
+func kubernetesSuffixedName(name, suffix string) string {
+	if len(name)+len(suffix) > 253 {
+		name = strings.TrimRight(name[:253-len(suffix)], "-")
+	}
+	return name + suffix
+}
+
+var kubernetesNamespaceRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// ExportKubernetes writes to w the YAML manifests of a ConfigMap, or a Secret,
+// with the PEM bundle of the given certificates, and optionally a
+// cert-manager ClusterIssuer and a trust-manager Bundle.
+func ExportKubernetes(w io.Writer, certs []*x509.Certificate, opts ...KubernetesOption) error {
+	if len(certs) == 0 {
+		return ErrNotFound
+	}
+
+	o := &kubernetesOptions{
+		name: kubernetesName(uniqueName(certs[0])),
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if o.namespace == "" {
+		o.namespace = "default"
+		if o.trustManager {
+			o.namespace = certManagerNamespace
+		}
+	}
+	if o.name == "" || o.name != kubernetesName(o.name) {
+		return fmt.Errorf("invalid Kubernetes name %q", o.name)
+	}
+	if !kubernetesNamespaceRegexp.MatchString(o.namespace) {
+		return fmt.Errorf("invalid Kubernetes namespace %q", o.namespace)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw})
+	if o.issuerKey != nil {
+		if _, err := tls.X509KeyPair(certPEM, o.issuerKey); err != nil {
+			return wrapError(err, "invalid ClusterIssuer key")
+		}
+	}
+
+	var bundle bytes.Buffer
+	for _, cert := range certs {
+		if err := pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+
+	y := &yamlWriter{w: w}
+	if o.secret {
+		y.document("v1", "Secret", o.name, o.namespace)
+		y.line(0, "type: Opaque")
+		y.line(0, "data:")
+		y.line(1, "ca.crt: "+base64.StdEncoding.EncodeToString(bundle.Bytes()))
+	} else {
+		y.document("v1", "ConfigMap", o.name, o.namespace)
+		y.line(0, "data:")
+		y.block(1, "ca.crt", bundle.String())
+	}
+
+	if o.issuerKey != nil {
+		secretName := kubernetesSuffixedName(o.name, "-key-pair")
+		y.document("v1", "Secret", secretName, certManagerNamespace)
+		y.line(0, "type: kubernetes.io/tls")
+		y.line(0, "data:")
+		y.line(1, "tls.crt: "+base64.StdEncoding.EncodeToString(certPEM))
+		y.line(1, "tls.key: "+base64.StdEncoding.EncodeToString(o.issuerKey))
+		y.document("cert-manager.io/v1", "ClusterIssuer", o.name, "")
+		y.line(0, "spec:")
+		y.line(1, "ca:")
+		y.line(2, "secretName: "+secretName)
+	}
+
+	if o.trustManager {
+		source := "configMap"
+		if o.secret {
+			source = "secret"
+		}
+		y.document("trust.cert-manager.io/v1alpha1", "Bundle", o.name, "")
+		y.line(0, "spec:")
+		y.line(1, "sources:")
+		y.line(1, "- "+source+":")
+		y.line(3, "name: "+o.name)
+		y.line(3, "key: ca.crt")
+		y.line(1, "target:")
+		y.line(2, "configMap:")
+		y.line(3, "key: ca-bundle.pem")
+	}
+
+	return y.err
+}
+
+// yamlWriter writes the simple YAML documents used by ExportKubernetes.
+type yamlWriter struct {
+	w     io.Writer
+	count int
+	err   error
+}
+
+func (y *yamlWriter) line(indent int, s string) {
+	if y.err == nil {
+		_, y.err = fmt.Fprintf(y.w, "%s%s\n", strings.Repeat("  ", indent), s)
+	}
+}
+
+// block writes a literal block scalar.
+func (y *yamlWriter) block(indent int, key, value string) {
+	y.line(indent, key+": |")
+	for _, s := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		y.line(indent+1, s)
+	}
+}
+
+func (y *yamlWriter) document(apiVersion, kind, name, namespace string) {
+	if y.count > 0 {
+		y.line(0, "---")
+	}
+	y.count++
+	y.line(0, "apiVersion: "+apiVersion)
+	y.line(0, "kind: "+kind)
+	y.line(0, "metadata:")
+	y.line(1, "name: "+name)
+	if namespace != "" {
+		y.line(1, "namespace: "+namespace)
+	}
+	y.line(1, "labels:")
+	y.line(2, "app.kubernetes.io/managed-by: truststore")
+}
@@ -24,6 +24,16 @@ var (
 
 	// SystemTrustCommand is the command used to update the system truststore.
 	SystemTrustCommand []string
+
+	// SystemBundleFiles are the possible locations of the system CA bundle.
+	SystemBundleFiles = []string{
+		"/etc/ssl/certs/ca-certificates.crt",
+		"/etc/pki/tls/certs/ca-bundle.crt",
+		"/etc/ssl/ca-bundle.pem",
+		"/etc/pki/tls/cacert.pem",
+		"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+		"/etc/ssl/cert.pem",
+	}
 )
 
 func init() {
@@ -103,6 +113,51 @@ func uninstallPlatform(_ string, cert *x509.Certificate) error {
 	return nil
 }
 
+// verifyPlatform checks that the certificate is in one of the CA bundles
+// generated by the SystemTrustCommand.
+func verifyPlatform(cert *x509.Certificate) error {
+	for _, filename := range SystemBundleFiles {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		for _, c := range parseCertificates(b) {
+			if c.Equal(cert) {
+				return nil
+			}
+		}
+	}
+	return ErrNotFound
+}
+
+// refreshPlatform runs the SystemTrustCommand to regenerate the system CA
+// bundles.
+func refreshPlatform() error {
+	if SystemTrustCommand == nil {
+		return ErrNotSupported
+	}
+	cmd := CommandWithSudo(SystemTrustCommand...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return NewCmdError(err, cmd, out)
+	}
+	return nil
+}
+
+// systemPaths returns the files used to install the certificate in the system
+// truststore.
+func systemPaths(cert *x509.Certificate) []string {
+	return []string{systemTrustFilename(cert)}
+}
+
+// listPlatform returns the certificates in the directory of the root
+// certificates.
+func listPlatform() ([]Entry, error) {
+	if SystemTrustCommand == nil {
+		return nil, ErrNotSupported
+	}
+	return listCertificateFiles(fmt.Sprintf(SystemTrustFilename, "*")), nil
+}
+
 func CommandWithSudo(cmd ...string) *exec.Cmd {
 	if _, err := exec.LookPath("sudo"); err != nil {
 		//nolint:gosec // tolerable risk necessary for function
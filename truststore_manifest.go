@@ -0,0 +1,431 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestVersion is the version of the manifest format.
+const manifestVersion = 1
+
+// SystemManifestDir is the directory of the manifest with the certificates
+// installed in the system truststore.
+var SystemManifestDir = func() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "truststore")
+	}
+	return "/var/lib/truststore"
+}()
+
+// Naming strategies recorded in the manifest, they correspond to the cases of
+// the name given by truststore to the certificates.
+const (
+	NamingPrefix     = "prefix"
+	NamingCommonName = "common-name"
+	NamingDefault    = "default"
+)
+
+// ManifestEntry records a certificate installed by truststore in a
+// truststore.
+type ManifestEntry struct {
+	// Fingerprint is the hex-encoded SHA-256 of the certificate.
+	Fingerprint string `json:"fingerprint"`
+	// Store is the name of the truststore, "system" or "user" for the system
+	// truststore and the per-user locations.
+	Store string `json:"store"`
+	// Name is the name used in the truststore, e.g. the Java alias or the NSS
+	// nickname.
+	Name string `json:"name"`
+	// Paths are the files that contain the certificate, if any.
+	Paths []string `json:"paths,omitempty"`
+	// Naming is the strategy used to name the certificate, and Prefix the
+	// prefix used with NamingPrefix.
+	Naming string `json:"naming"`
+	Prefix string `json:"prefix,omitempty"`
+	// Raw is the DER-encoded certificate.
+	Raw         []byte    `json:"certificate"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+// Certificate parses the certificate of the entry.
+func (e ManifestEntry) Certificate() (*x509.Certificate, error) {
+	return x509.ParseCertificate(e.Raw)
+}
+
+type manifest struct {
+	Version int             `json:"version"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// userStateDir returns the directory where truststore keeps the per-user
+// state, $XDG_STATE_HOME/truststore or ~/.local/state/truststore.
+func userStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "truststore")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "state", "truststore")
+}
+
+// manifestFilename returns the manifest used for the given store, the system
+// truststore is recorded in SystemManifestDir.
+func manifestFilename(store string) string {
+	if store == "system" {
+		return filepath.Join(SystemManifestDir, "manifest.json")
+	}
+	return filepath.Join(userStateDir(), "manifest.json")
+}
+
+func readManifest(filename string) (*manifest, error) {
+	m := &manifest{Version: manifestVersion}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, wrapError(err, "error parsing "+filename)
+	}
+	return m, nil
+}
+
+func writeManifest(filename string, m *manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if filepath.Dir(filename) == SystemManifestDir {
+		return writeFileAsRoot(filename, b, 0644)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	//nolint:gosec // the manifest only contains public certificates
+	return os.WriteFile(filename, b, 0644)
+}
+
+// fingerprint returns the hex-encoded SHA-256 of the certificate.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// naming returns the naming strategy used by uniqueName.
+func naming(cert *x509.Certificate) string {
+	switch {
+	case prefix != "":
+		return NamingPrefix
+	case cert.Subject.CommonName != "":
+		return NamingCommonName
+	default:
+		return NamingDefault
+	}
+}
+
+// recordInstall adds the certificate installed in the given store to the
+// manifest, an existing entry keeps its install time. Errors are only logged,
+// the manifest does not affect the install.
+func recordInstall(store string, paths []string, cert *x509.Certificate) {
+	filename := manifestFilename(store)
+	m, err := readManifest(filename)
+	if err != nil {
+		debug("failed to read manifest: %v", err)
+		return
+	}
+
+	entry := ManifestEntry{
+		Fingerprint: fingerprint(cert),
+		Store:       store,
+		Name:        uniqueName(cert),
+		Paths:       paths,
+		Naming:      naming(cert),
+		Prefix:      prefix,
+		Raw:         cert.Raw,
+		InstalledAt: time.Now().UTC(),
+	}
+	replaced := false
+	for i, e := range m.Entries {
+		if e.Fingerprint == entry.Fingerprint && e.Store == store {
+			if !e.InstalledAt.IsZero() {
+				entry.InstalledAt = e.InstalledAt
+			}
+			m.Entries[i], replaced = entry, true
+		}
+	}
+	if !replaced {
+		m.Entries = append(m.Entries, entry)
+	}
+	m.Version = manifestVersion
+
+	if err := writeManifest(filename, m); err != nil {
+		debug("failed to write manifest: %v", err)
+	}
+}
+
+// recordUninstall removes the certificate uninstalled from the given store
+// from the manifest.
+func recordUninstall(store string, cert *x509.Certificate) {
+	filename := manifestFilename(store)
+	m, err := readManifest(filename)
+	if err != nil {
+		debug("failed to read manifest: %v", err)
+		return
+	}
+
+	fp := fingerprint(cert)
+	entries := m.Entries[:0]
+	for _, e := range m.Entries {
+		if e.Fingerprint != fp || e.Store != store {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(m.Entries) {
+		return
+	}
+	m.Entries = entries
+
+	if len(m.Entries) == 0 && store != "system" {
+		err = os.Remove(filename)
+	} else {
+		err = writeManifest(filename, m)
+	}
+	if err != nil {
+		debug("failed to write manifest: %v", err)
+	}
+}
+
+// List returns the certificates installed by truststore, as recorded in the
+// per-user manifest, in $XDG_STATE_HOME/truststore, and in the system
+// manifest, in SystemManifestDir.
+func List() ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	for _, store := range []string{"user", "system"} {
+		m, err := readManifest(manifestFilename(store))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, m.Entries...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].InstalledAt.Before(entries[j].InstalledAt)
+	})
+	return entries, nil
+}
+
+// managedName returns the name recorded in the manifest for the certificate.
+func managedName(cert *x509.Certificate) (string, bool) {
+	entries, err := List()
+	if err != nil {
+		return "", false
+	}
+	fp := fingerprint(cert)
+	for _, e := range entries {
+		if e.Fingerprint == fp {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
+
+// nameOverrides are the names used by uniqueName instead of the computed ones,
+// indexed by fingerprint. They are set with the names in the manifest while
+// uninstalling a certificate.
+var (
+	nameOverridesMu sync.RWMutex
+	nameOverrides   = map[string]string{}
+)
+
+// nameOverride returns the name set with useManagedName for the certificate.
+func nameOverride(cert *x509.Certificate) (string, bool) {
+	nameOverridesMu.RLock()
+	defer nameOverridesMu.RUnlock()
+	name, ok := nameOverrides[fingerprint(cert)]
+	return name, ok
+}
+
+// useManagedName makes uniqueName return the name recorded in the manifest for
+// the certificate, so it can be uninstalled even if the prefix changed. It
+// returns a function to restore the computed name.
+func useManagedName(cert *x509.Certificate) func() {
+	name, ok := managedName(cert)
+	if !ok {
+		return func() {}
+	}
+	fp := fingerprint(cert)
+	nameOverridesMu.Lock()
+	nameOverrides[fp] = name
+	nameOverridesMu.Unlock()
+	return func() {
+		nameOverridesMu.Lock()
+		delete(nameOverrides, fp)
+		nameOverridesMu.Unlock()
+	}
+}
+
+// UninstallManaged uninstalls all the certificates recorded in the manifests
+// from the stores where they were installed. Only the enabled trusts are used,
+// the system truststore and the per-user locations are used if they are
+// recorded.
+func UninstallManaged(opts ...Option) error {
+	entries, err := List()
+	if err != nil {
+		return err
+	}
+
+	var certs []*x509.Certificate
+	stores := make(map[string]map[string][]string)
+	for _, e := range entries {
+		if _, ok := stores[e.Fingerprint]; !ok {
+			cert, err := e.Certificate()
+			if err != nil {
+				return wrapError(err, "error parsing manifest certificate "+e.Fingerprint)
+			}
+			certs = append(certs, cert)
+			stores[e.Fingerprint] = make(map[string][]string)
+		}
+		stores[e.Fingerprint][e.Store] = e.Paths
+	}
+
+	o := newOptions(opts)
+	for _, cert := range certs {
+		if err := uninstallManaged(cert, stores[fingerprint(cert)], o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstallManaged uninstalls the certificate from the stores, indexed by name
+// with the paths recorded in the manifest.
+func uninstallManaged(cert *x509.Certificate, stores map[string][]string, o *options) error {
+	filename, fn, err := saveTempCert(cert)
+	defer fn()
+	if err != nil {
+		return err
+	}
+	restore := useManagedName(cert)
+	defer restore()
+
+	// Use only the recorded stores, with the recorded files.
+	mo := *o
+	mo.trusts = make(map[string]Trust)
+	for name, t := range o.trusts {
+		paths, ok := stores[name]
+		if !ok {
+			continue
+		}
+		if mt, err := managedTrust(t, paths); err == nil {
+			mo.trusts[name] = mt
+		} else {
+			mo.trusts[name] = &failedTrust{name: name, err: err}
+		}
+	}
+
+	if err := backup(cert, &mo); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, t := range mo.sortedTrusts() {
+		if err := t.PreCheck(); err != nil {
+			debug(err.Error())
+			o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error(), Certificate: cert})
+			continue
+		}
+		path := firstPath(trustPaths(t, cert))
+		if err := t.Uninstall(filename, cert); err != nil {
+			o.report(Result{Trust: t.Name(), Action: ActionFailed, Err: err, Path: path, Certificate: cert})
+			errs = append(errs, err)
+			continue
+		}
+		recordUninstall(t.Name(), cert)
+		o.report(Result{Trust: t.Name(), Action: ActionUninstalled, Path: path, Certificate: cert})
+	}
+
+	if _, ok := stores["user"]; ok {
+		if err := uninstallUserScope(cert); err != nil {
+			o.report(Result{Trust: "user", Action: ActionFailed, Err: err, Path: userBundleFilename(), Certificate: cert})
+			errs = append(errs, err)
+		} else {
+			recordUninstall("user", cert)
+			o.report(Result{Trust: "user", Action: ActionUninstalled, Path: userBundleFilename(), Certificate: cert})
+		}
+	}
+
+	if _, ok := stores["system"]; ok && !o.withNoSystem {
+		if err := uninstallPlatform(filename, cert); err != nil {
+			o.report(Result{Trust: "system", Action: ActionFailed, Err: err, Path: firstPath(systemPaths(cert)), Certificate: cert})
+			errs = append(errs, err)
+		} else {
+			recordUninstall("system", cert)
+			o.report(Result{Trust: "system", Action: ActionUninstalled, Path: firstPath(systemPaths(cert)), Certificate: cert})
+		}
+	}
+	return joinErrors(errs)
+}
+
+// managedTrust returns the trust using the files recorded in the manifest for
+// the Java and NSS trusts, so the certificate is uninstalled from the keystore
+// and the databases it was installed in even if JAVA_HOME or the profiles
+// changed. Other trusts are returned as they are.
+func managedTrust(t Trust, paths []string) (Trust, error) {
+	if len(paths) == 0 {
+		return t, nil
+	}
+	switch t.Name() {
+	case "java":
+		jt, err := NewJavaKeystoreTrust(paths[0])
+		if err != nil {
+			return nil, err
+		}
+		// Keep the name of the default keystore, it is the one in the manifest.
+		jt.keystore = false
+		return jt, nil
+	case "nss":
+		var dirs []string
+		for _, p := range paths {
+			if dir := filepath.Dir(p); !containsString(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+		return NewNSSProfileTrust(dirs...)
+	default:
+		return t, nil
+	}
+}
+
+// pathTrust is implemented by the trusts that keep the certificates in files.
+type pathTrust interface {
+	// paths returns the files modified to install the certificate.
+	paths(cert *x509.Certificate) []string
+}
+
+// firstPath returns the first of the paths, the main file of a trust, or an
+// empty string.
+func firstPath(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[0]
+}
+
+// trustPaths returns the files used by the trust for the certificate.
+func trustPaths(t Trust, cert *x509.Certificate) []string {
+	if p, ok := t.(pathTrust); ok {
+		return p.paths(cert)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// NodeTrust implements a Trust for Node.js. Node.js does not use the system
+// truststore, NodeTrust maintains a PEM bundle with the installed certificates
+// and an environment snippet that exports NODE_EXTRA_CA_CERTS with it.
+type NodeTrust struct {
+	bundle *caBundle
+}
+
+// NewNodeTrust creates a new NodeTrust if Node.js is installed.
+func NewNodeTrust() (*NodeTrust, error) {
+	if _, err := exec.LookPath("node"); err != nil {
+		// Node.js installed with nvm is only in the PATH of interactive shells.
+		home, _ := os.UserHomeDir()
+		matches, _ := filepath.Glob(filepath.Join(home, ".nvm", "versions", "node", "*", "bin", "node"))
+		if len(matches) == 0 {
+			return nil, trustNotFound("node not found in PATH or in nvm")
+		}
+	}
+
+	return &NodeTrust{
+		bundle: &caBundle{
+			path: filepath.Join(userDataDir(), "node-extra-ca-certs.pem"),
+		},
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *NodeTrust) Name() string {
+	return "node"
+}
+
+// Install implements the Trust interface.
+func (t *NodeTrust) Install(_ string, cert *x509.Certificate) error {
+	if err := t.bundle.add(cert); err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+	if err := writeEnvSnippet(t.Name(), []envVar{
+		{"NODE_EXTRA_CA_CERTS", t.bundle.path},
+	}); err != nil {
+		return err
+	}
+
+	debug("certificate installed properly in %s", t.bundle.path)
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *NodeTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	empty, err := t.bundle.remove(cert)
+	if err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+	if empty {
+		if err := removeEnvSnippet(t.Name()); err != nil {
+			return err
+		}
+	}
+
+	debug("certificate uninstalled properly from %s", t.bundle.path)
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in the managed bundle.
+func (t *NodeTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	return t.bundle.contains(cert)
+}
+
+// List implements the Lister interface.
+func (t *NodeTrust) List() ([]Entry, error) {
+	return t.bundle.entries(), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *NodeTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf(`warning: "node" is not available, install Node.js to use the Node trust`)
+}
+
+// paths implements the pathTrust interface.
+func (t *NodeTrust) paths(_ *x509.Certificate) []string {
+	return append([]string{t.bundle.path}, envSnippetPaths(t.Name())...)
+}
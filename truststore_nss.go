@@ -18,6 +18,7 @@ var nssDB = filepath.Join(os.Getenv("HOME"), ".pki", "nssdb")
 // NSSTrust implements a Trust for Firefox or other NSS based applications.
 type NSSTrust struct {
 	certutilPath string
+	profiles     []string
 }
 
 // NewNSSTrust creates a new NSSTrust.
@@ -28,19 +29,27 @@ func NewNSSTrust() (*NSSTrust, error) {
 	case "darwin":
 		certutilPath, err = exec.LookPath("certutil")
 		if err != nil {
-			cmd := exec.Command("brew", "--prefix", "nss")
+			brewPath, err := exec.LookPath("brew")
+			if err != nil {
+				return nil, trustNotFound("certutil not found in PATH, install it with \"%s\"", CertutilInstallHelp)
+			}
+			//nolint:gosec // tolerable risk necessary for function
+			cmd := exec.Command(brewPath, "--prefix", "nss")
 			out, err1 := cmd.Output()
 			if err1 != nil {
 				return nil, NewCmdError(err1, cmd, out)
 			}
 			certutilPath = filepath.Join(strings.TrimSpace(string(out)), "bin", "certutil")
 			if _, err = os.Stat(certutilPath); err != nil {
+				if os.IsNotExist(err) {
+					return nil, trustNotFound("%s not found, install it with \"%s\"", certutilPath, CertutilInstallHelp)
+				}
 				return nil, err
 			}
 		}
 	case "linux":
 		if certutilPath, err = exec.LookPath("certutil"); err != nil {
-			return nil, err
+			return nil, trustNotFound("certutil not found in PATH, install it with \"%s\"", CertutilInstallHelp)
 		}
 	default:
 		return nil, ErrTrustNotSupported
@@ -51,6 +60,18 @@ func NewNSSTrust() (*NSSTrust, error) {
 	}, nil
 }
 
+// NewNSSProfileTrust creates a new NSSTrust that only uses the NSS security
+// databases in the directories matching the given patterns, instead of the
+// Firefox profiles and the shared database used by Chrome.
+func NewNSSProfileTrust(patterns ...string) (*NSSTrust, error) {
+	t, err := NewNSSTrust()
+	if err != nil {
+		return nil, err
+	}
+	t.profiles = patterns
+	return t, nil
+}
+
 // Name implements the Trust interface.
 func (t *NSSTrust) Name() string {
 	return "nss"
@@ -59,7 +80,7 @@ func (t *NSSTrust) Name() string {
 // Install implements the Trust interface.
 func (t *NSSTrust) Install(filename string, cert *x509.Certificate) error {
 	// install certificate in all profiles
-	if forEachNSSProfile(func(profile string) {
+	if t.forEachProfile(func(profile string) {
 		//nolint:gosec // tolerable risk necessary for function
 		cmd := exec.Command(t.certutilPath, "-A", "-d", profile, "-t", "C,,", "-n", uniqueName(cert), "-i", filename)
 		out, err := cmd.CombinedOutput()
@@ -81,7 +102,7 @@ func (t *NSSTrust) Install(filename string, cert *x509.Certificate) error {
 
 // Uninstall implements the Trust interface.
 func (t *NSSTrust) Uninstall(_ string, cert *x509.Certificate) (err error) {
-	forEachNSSProfile(func(profile string) {
+	t.forEachProfile(func(profile string) {
 		if err != nil {
 			return
 		}
@@ -108,7 +129,7 @@ func (t *NSSTrust) Uninstall(_ string, cert *x509.Certificate) (err error) {
 // already installed.
 func (t *NSSTrust) Exists(cert *x509.Certificate) bool {
 	success := true
-	if forEachNSSProfile(func(profile string) {
+	if t.forEachProfile(func(profile string) {
 		//nolint:gosec // tolerable risk necessary for function
 		err := exec.Command(t.certutilPath, "-V", "-d", profile, "-u", "L", "-n", uniqueName(cert)).Run()
 		if err != nil {
@@ -120,10 +141,39 @@ func (t *NSSTrust) Exists(cert *x509.Certificate) bool {
 	return success
 }
 
+// List implements the Lister interface. It returns the certificates in all
+// the NSS security databases.
+func (t *NSSTrust) List() (entries []Entry, err error) {
+	t.forEachProfile(func(profile string) {
+		if err != nil {
+			return
+		}
+		//nolint:gosec // tolerable risk necessary for function
+		cmd := exec.Command(t.certutilPath, "-L", "-d", profile)
+		out, err1 := cmd.CombinedOutput()
+		if err1 != nil {
+			err = NewCmdError(err1, cmd, out)
+			return
+		}
+		for _, nickname := range nssTrustedNicknames(out) {
+			//nolint:gosec // tolerable risk necessary for function
+			out, err := exec.Command(t.certutilPath, "-L", "-d", profile, "-n", nickname, "-a").Output()
+			if err != nil {
+				debug("failed to execute \"certutil -L -n %s\": %s", nickname, err)
+				continue
+			}
+			for _, cert := range parseCertificates(out) {
+				entries = appendEntry(entries, Entry{Name: nickname, Certificate: cert})
+			}
+		}
+	})
+	return
+}
+
 // PreCheck implements the Trust interface.
 func (t *NSSTrust) PreCheck() error {
 	if t != nil {
-		if forEachNSSProfile(func(_ string) {}) == 0 {
+		if t.forEachProfile(func(_ string) {}) == 0 {
 			return fmt.Errorf("not NSS security databases found")
 		}
 		return nil
@@ -136,10 +186,58 @@ func (t *NSSTrust) PreCheck() error {
 	return fmt.Errorf(`warning: "certutil" is not available, install "certutil" with "%s" and try again`, CertutilInstallHelp)
 }
 
-func forEachNSSProfile(f func(profile string)) (found int) {
-	profiles, _ := filepath.Glob(NSSProfile)
-	if _, err := os.Stat(nssDB); err == nil {
-		profiles = append(profiles, nssDB)
+// paths implements the pathTrust interface.
+func (t *NSSTrust) paths(cert *x509.Certificate) []string {
+	var files []string
+	t.forEachProfile(func(profile string) {
+		db, dir, _ := strings.Cut(profile, ":")
+		names := []string{"cert9.db", "key4.db", "pkcs11.txt"}
+		if db == "dbm" {
+			names = []string{"cert8.db", "key3.db", "secmod.db"}
+		}
+		for _, name := range names {
+			files = append(files, filepath.Join(dir, name))
+		}
+	})
+	return files
+}
+
+// nssTrustedNicknames returns the nicknames of the trusted certificate
+// authorities in the output of "certutil -L". Each line has the nickname
+// followed by the trust attributes for SSL, S/MIME and code signing, e.g.
+// "CT,C,C". Only the certificates trusted to issue server certificates, with C
+// or T in the SSL attributes, are returned, the ones without trust, the user
+// certificates (u) and the distrusted ones (p) are skipped.
+func nssTrustedNicknames(out []byte) []string {
+	var nicknames []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(line, "Certificate Nickname") {
+			continue
+		}
+		attrs := fields[len(fields)-1]
+		ssl, _, _ := strings.Cut(attrs, ",")
+		if !strings.ContainsAny(ssl, "CT") || strings.Contains(ssl, "p") {
+			continue
+		}
+		nickname := strings.TrimSpace(strings.TrimSuffix(line, attrs))
+		nicknames = append(nicknames, nickname)
+	}
+	return nicknames
+}
+
+func (t *NSSTrust) forEachProfile(f func(profile string)) (found int) {
+	var profiles []string
+	if len(t.profiles) == 0 {
+		profiles, _ = filepath.Glob(NSSProfile)
+		if _, err := os.Stat(nssDB); err == nil {
+			profiles = append(profiles, nssDB)
+		}
+	}
+	for _, pattern := range t.profiles {
+		matches, _ := filepath.Glob(pattern)
+		profiles = append(profiles, matches...)
 	}
 	if len(profiles) == 0 {
 		return
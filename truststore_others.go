@@ -11,6 +11,9 @@ var (
 
 	// CertutilInstallHelp is the command to add NSS support.
 	CertutilInstallHelp = ""
+
+	// SystemBundleFiles are the possible locations of the system CA bundle.
+	SystemBundleFiles []string
 )
 
 func installPlatform(string, *x509.Certificate) error {
@@ -20,3 +23,19 @@ func installPlatform(string, *x509.Certificate) error {
 func uninstallPlatform(string, *x509.Certificate) error {
 	return ErrTrustNotSupported
 }
+
+func listPlatform() ([]Entry, error) {
+	return nil, ErrNotSupported
+}
+
+func verifyPlatform(*x509.Certificate) error {
+	return ErrTrustNotSupported
+}
+
+func systemPaths(*x509.Certificate) []string {
+	return nil
+}
+
+func refreshPlatform() error {
+	return ErrTrustNotSupported
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// PHPTrust implements a Trust for PHP. It maintains a bundle with the system
+// roots and the installed certificates, an ini file that sets openssl.cafile
+// and curl.cainfo to it, and an environment snippet that adds the ini
+// directory to PHP_INI_SCAN_DIR.
+type PHPTrust struct {
+	iniDir string
+	bundle *caBundle
+}
+
+// NewPHPTrust creates a new PHPTrust if PHP is installed.
+func NewPHPTrust() (*PHPTrust, error) {
+	if _, err := exec.LookPath("php"); err != nil {
+		return nil, trustNotFound("php not found in PATH")
+	}
+	return &PHPTrust{
+		iniDir: filepath.Join(userDataDir(), "php.d"),
+		bundle: &caBundle{
+			path:        filepath.Join(userDataDir(), "php-ca-bundle.pem"),
+			systemRoots: true,
+		},
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *PHPTrust) Name() string {
+	return "php"
+}
+
+// Install implements the Trust interface.
+func (t *PHPTrust) Install(_ string, cert *x509.Certificate) error {
+	if err := t.bundle.add(cert); err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+
+	if err := os.MkdirAll(t.iniDir, 0755); err != nil {
+		return err
+	}
+	ini := fmt.Sprintf("; This file is managed by truststore, do not edit.\nopenssl.cafile=%q\ncurl.cainfo=%q\n", t.bundle.path, t.bundle.path)
+	//nolint:gosec // the ini file does not contain secrets
+	if err := os.WriteFile(t.iniFilename(), []byte(ini), 0644); err != nil {
+		return wrapError(err, "failed to write "+t.iniFilename())
+	}
+
+	// An empty element in PHP_INI_SCAN_DIR is replaced by the default scan
+	// directory.
+	scanDir := os.Getenv("PHP_INI_SCAN_DIR")
+	if scanDir == "" {
+		scanDir = string(os.PathListSeparator) + t.iniDir
+	} else if !containsString(filepath.SplitList(scanDir), t.iniDir) {
+		scanDir += string(os.PathListSeparator) + t.iniDir
+	}
+	if err := writeEnvSnippet(t.Name(), []envVar{
+		{"PHP_INI_SCAN_DIR", scanDir},
+	}); err != nil {
+		return err
+	}
+
+	debug("certificate installed properly in %s", t.bundle.path)
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *PHPTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	empty, err := t.bundle.remove(cert)
+	if err != nil {
+		return wrapError(err, "failed to write "+t.bundle.path)
+	}
+	if empty {
+		if err := os.Remove(t.iniFilename()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(t.iniDir)
+		if err := removeEnvSnippet(t.Name()); err != nil {
+			return err
+		}
+	}
+
+	debug("certificate uninstalled properly from %s", t.bundle.path)
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in the bundle and the ini file is present.
+func (t *PHPTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil || !t.bundle.contains(cert) {
+		return false
+	}
+	_, err := os.Stat(t.iniFilename())
+	return err == nil
+}
+
+// List implements the Lister interface.
+func (t *PHPTrust) List() ([]Entry, error) {
+	return t.bundle.entries(), nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *PHPTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf(`warning: "php" is not available, install PHP to use the PHP trust`)
+}
+
+// paths implements the pathTrust interface.
+func (t *PHPTrust) paths(_ *x509.Certificate) []string {
+	return append([]string{t.bundle.path, t.iniFilename()}, envSnippetPaths(t.Name())...)
+}
+
+func (t *PHPTrust) iniFilename() string {
+	return filepath.Join(t.iniDir, "truststore.ini")
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+var (
+	oidDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+const pkcs12Iterations = 2048
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+type safeBag struct {
+	ID    asn1.ObjectIdentifier
+	Value certBag `asn1:"explicit,tag:0"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"explicit,tag:0"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm algorithmIdentifier
+	Digest    []byte
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// encodePKCS12Certificate returns a PKCS #12 file with the given certificate.
+// The file is not encrypted and its integrity is protected with an empty
+// password.
+func encodePKCS12Certificate(cert *x509.Certificate) ([]byte, error) {
+	bags, err := asn1.Marshal([]safeBag{{
+		ID: oidCertBag,
+		Value: certBag{
+			ID:   oidCertTypeX509,
+			Data: cert.Raw,
+		},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := asn1.Marshal([]contentInfo{{
+		ContentType: oidDataContentType,
+		Content:     bags,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, pkcs12MacKey(salt, pkcs12Iterations))
+	mac.Write(authSafe)
+
+	return asn1.Marshal(pfxPdu{
+		Version: 3,
+		AuthSafe: contentInfo{
+			ContentType: oidDataContentType,
+			Content:     authSafe,
+		},
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: algorithmIdentifier{
+					Algorithm:  oidSHA256,
+					Parameters: asn1.NullRawValue,
+				},
+				Digest: mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// pkcs12MacKey derives the MAC key for an empty password using SHA-256 and the
+// key derivation function of RFC 7292, appendix B.2. The key has the same size
+// as the hash, so only one round of the function is needed.
+func pkcs12MacKey(salt []byte, iterations int) []byte {
+	const u, v = sha256.Size, sha256.BlockSize
+
+	// The empty password is encoded as a null terminated BMPString.
+	password := []byte{0, 0}
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		n := (len(b) + v - 1) / v * v
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = 3 // MAC material
+	}
+	h := sha256.New()
+	h.Write(d)
+	h.Write(fill(salt))
+	h.Write(fill(password))
+	a := h.Sum(nil)
+	for i := 1; i < iterations; i++ {
+		sum := sha256.Sum256(a)
+		a = sum[:]
+	}
+	return a[:u]
+}
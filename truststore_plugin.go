@@ -0,0 +1,217 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// PluginPrefix is the prefix of the executables that implement a trust. The
+// plugin "example" is the executable truststore-trust-example in the PATH.
+const PluginPrefix = "truststore-trust-"
+
+// pluginVersion is the version of the plugin protocol.
+const pluginVersion = 1
+
+// Plugin operations, the operation is sent in the request.
+const (
+	PluginPreCheck  = "precheck"
+	PluginExists    = "exists"
+	PluginInstall   = "install"
+	PluginUninstall = "uninstall"
+	PluginList      = "list"
+)
+
+// PluginRequest is the JSON document written to the standard input of a
+// plugin. The certificate fields are set in the exists, install and uninstall
+// operations.
+type PluginRequest struct {
+	Version   int    `json:"version"`
+	Operation string `json:"operation"`
+	// Name is the name of the certificate in the truststores, plugins should
+	// use it to name or locate the certificate.
+	Name        string `json:"name,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Filename is a file with the PEM certificate.
+	Filename string `json:"filename,omitempty"`
+}
+
+// PluginResponse is the JSON document that a plugin writes to the standard
+// output. An operation fails if the plugin exits with a non-zero status or if
+// Error is set, the standard error is used in the error message.
+type PluginResponse struct {
+	Error string `json:"error,omitempty"`
+	// Exists is returned by the exists operation.
+	Exists bool `json:"exists,omitempty"`
+	// Certificates are returned by the list operation.
+	Certificates []PluginCertificate `json:"certificates,omitempty"`
+}
+
+// PluginCertificate is a certificate returned by the list operation.
+type PluginCertificate struct {
+	Name        string `json:"name"`
+	Certificate string `json:"certificate"`
+}
+
+// PluginTrust implements a Trust with an external executable that speaks
+// JSON over its standard input and output. The executable is run once per
+// operation with a PluginRequest, and must write a PluginResponse.
+type PluginTrust struct {
+	name string
+	path string
+}
+
+// NewPluginTrust creates a new PluginTrust for the plugin with the given name,
+// the executable PluginPrefix+name is searched in the PATH. The name of the
+// trust is the plugin name, so it can be selected again, e.g. to uninstall the
+// certificates recorded in the manifest.
+func NewPluginTrust(name string) (*PluginTrust, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid plugin name %q", name)
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, trustNotFound("%s not found in PATH", PluginPrefix+name)
+	}
+	return &PluginTrust{name: name, path: path}, nil
+}
+
+// Plugins returns the names of the plugins found in the PATH.
+func Plugins() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if !strings.HasPrefix(name, PluginPrefix) || e.IsDir() {
+				continue
+			}
+			if name = strings.TrimPrefix(name, PluginPrefix); name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name implements the Trust interface.
+func (t *PluginTrust) Name() string {
+	if t == nil {
+		return ""
+	}
+	return t.name
+}
+
+// Install implements the Trust interface.
+func (t *PluginTrust) Install(filename string, cert *x509.Certificate) error {
+	_, err := t.call(pluginCertificateRequest(PluginInstall, filename, cert))
+	return err
+}
+
+// Uninstall implements the Trust interface.
+func (t *PluginTrust) Uninstall(filename string, cert *x509.Certificate) error {
+	_, err := t.call(pluginCertificateRequest(PluginUninstall, filename, cert))
+	return err
+}
+
+// Exists implements the Trust interface.
+func (t *PluginTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	resp, err := t.call(pluginCertificateRequest(PluginExists, "", cert))
+	if err != nil {
+		debug(err.Error())
+		return false
+	}
+	return resp.Exists
+}
+
+// PreCheck implements the Trust interface.
+func (t *PluginTrust) PreCheck() error {
+	if t == nil {
+		return fmt.Errorf("warning: the truststore plugin is not available")
+	}
+	_, err := t.call(&PluginRequest{Operation: PluginPreCheck})
+	return err
+}
+
+// List implements the Lister interface.
+func (t *PluginTrust) List() ([]Entry, error) {
+	resp, err := t.call(&PluginRequest{Operation: PluginList})
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, c := range resp.Certificates {
+		for _, cert := range parseCertificates([]byte(c.Certificate)) {
+			entries = append(entries, Entry{Name: c.Name, Certificate: cert})
+		}
+	}
+	return entries, nil
+}
+
+func pluginCertificateRequest(op, filename string, cert *x509.Certificate) *PluginRequest {
+	return &PluginRequest{
+		Operation: op,
+		Name:      uniqueName(cert),
+		Certificate: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})),
+		Fingerprint: fingerprint(cert),
+		Filename:    filename,
+	}
+}
+
+// call runs the plugin with the request and returns its response.
+func (t *PluginTrust) call(req *PluginRequest) (*PluginResponse, error) {
+	req.Version = pluginVersion
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(t.path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, NewCmdError(err, cmd, stderr.Bytes())
+	}
+
+	resp := new(PluginResponse)
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, NewCmdError(fmt.Errorf("invalid response: %w", err), cmd, stdout.Bytes())
+	}
+	if resp.Error != "" {
+		return nil, NewCmdError(errors.New(resp.Error), cmd, stderr.Bytes())
+	}
+	return resp, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+// PoolOption is the type used to pass custom options to CertPool and
+// WriteBundle.
+type PoolOption func(*poolOptions)
+
+type poolOptions struct {
+	noSystem  bool
+	nssDBs    []string
+	keystores []string
+}
+
+// WithPoolNoSystem does not include the system roots.
+func WithPoolNoSystem() PoolOption {
+	return func(o *poolOptions) {
+		o.noSystem = true
+	}
+}
+
+// WithPoolNSSDatabase includes the certificates in the NSS security database
+// in the given directory. It requires certutil.
+func WithPoolNSSDatabase(dir string) PoolOption {
+	return func(o *poolOptions) {
+		o.nssDBs = append(o.nssDBs, dir)
+	}
+}
+
+// WithPoolJavaKeystore includes the certificates in the given Java keystore,
+// read with JavaStorePass. It requires keytool.
+func WithPoolJavaKeystore(keystore string) PoolOption {
+	return func(o *poolOptions) {
+		o.keystores = append(o.keystores, keystore)
+	}
+}
+
+// CertPool returns a pool with the system roots and the certificates
+// installed by truststore, as recorded in the manifests. The certificates in
+// NSS security databases and Java keystores can be added with
+// WithPoolNSSDatabase and WithPoolJavaKeystore.
+//
+// The pool can be used as the RootCAs of a tls.Config to trust the
+// certificates even if they are not installed in the system truststore.
+func CertPool(opts ...PoolOption) (*x509.CertPool, error) {
+	o := new(poolOptions)
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	certs, err := poolCertificates(o)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !o.noSystem {
+		if pool, err = x509.SystemCertPool(); err != nil {
+			return nil, wrapError(err, "failed to load the system roots")
+		}
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// WriteBundle writes a PEM bundle with the certificates that CertPool would
+// use. The system roots are read from the first of SystemBundleFiles found,
+// on systems without a CA bundle WithPoolNoSystem is required. The
+// certificates installed by truststore are delimited with the same markers
+// used in the bundles that truststore maintains.
+func WriteBundle(w io.Writer, opts ...PoolOption) error {
+	o := new(poolOptions)
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	certs, err := poolCertificates(o)
+	if err != nil {
+		return err
+	}
+
+	var data, system []byte
+	if !o.noSystem {
+		if system = systemRoots(); system == nil {
+			return fmt.Errorf("system CA bundle not found")
+		}
+		data = append(data, system...)
+	}
+	roots := parseCertificates(system)
+	for _, cert := range certs {
+		if !containsCertificate(roots, cert) {
+			data = appendBundleCertificate(data, cert)
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// poolCertificates returns the certificates in the manifests and in the
+// stores set in the options.
+func poolCertificates(o *poolOptions) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	add := func(cert *x509.Certificate) {
+		if !containsCertificate(certs, cert) {
+			certs = append(certs, cert)
+		}
+	}
+
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		cert, err := e.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		add(cert)
+	}
+
+	for _, dir := range o.nssDBs {
+		t, err := NewNSSProfileTrust(dir)
+		if err != nil {
+			return nil, wrapError(err, "failed to read NSS security database "+dir)
+		}
+		if t.forEachProfile(func(string) {}) == 0 {
+			return nil, fmt.Errorf("NSS security database not found in %s", dir)
+		}
+		list, err := t.List()
+		if err != nil {
+			return nil, wrapError(err, "failed to read NSS security database "+dir)
+		}
+		for _, e := range list {
+			add(e.Certificate)
+		}
+	}
+
+	for _, keystore := range o.keystores {
+		t, err := NewJavaKeystoreTrust(keystore)
+		if err != nil {
+			return nil, wrapError(err, "failed to read Java keystore "+keystore)
+		}
+		list, err := t.List()
+		if err != nil {
+			return nil, wrapError(err, "failed to read Java keystore "+keystore)
+		}
+		for _, e := range list {
+			add(e.Certificate)
+		}
+	}
+	return certs, nil
+}
+
+// containsCertificate returns if the certificate is in the list.
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is a certificate installed in a truststore with the name used in it,
+// e.g. the NSS nickname, the Java alias or the file name without extension.
+type Entry struct {
+	Name        string
+	Certificate *x509.Certificate
+}
+
+// Lister is the interface implemented by the trusts that can list the
+// certificates installed in them.
+type Lister interface {
+	List() ([]Entry, error)
+}
+
+// PruneReason is the reason why a certificate is pruned.
+type PruneReason string
+
+const (
+	// PruneExpired indicates that the certificate has expired.
+	PruneExpired PruneReason = "expired"
+	// PruneSuperseded indicates that there is a newer certificate with the
+	// same subject or key.
+	PruneSuperseded PruneReason = "superseded"
+)
+
+// Stale is a certificate installed by truststore that is expired or
+// superseded.
+type Stale struct {
+	Certificate *x509.Certificate
+	Reason      PruneReason
+	// Trusts are the truststores where the certificate was found.
+	Trusts []string
+}
+
+// Prune finds the certificates installed by truststore that are expired, or
+// superseded by a newer certificate with the same subject or key, and
+// uninstalls them from all the enabled truststores. It returns the stale
+// certificates found, with WithDryRun they are not uninstalled. A failure to
+// list a truststore or to uninstall a certificate does not stop the others,
+// the errors are returned in a MultiError if there is more than one.
+//
+// The certificates are found in the enabled trusts that implement Lister and
+// in the system truststore on Linux and FreeBSD. Only the certificates named
+// as truststore names them, or recorded in the manifest, are considered.
+func Prune(opts ...Option) ([]Stale, error) {
+	o := newOptions(opts)
+
+	// The certificates recorded in the manifest are managed even if the name
+	// has changed.
+	recorded := make(map[string]bool)
+	if manifest, err := List(); err == nil {
+		for _, e := range manifest {
+			recorded[e.Fingerprint] = true
+		}
+	}
+
+	var errs []error
+	var certs []*x509.Certificate
+	found := make(map[string][]string)
+	add := func(trust string, entries []Entry) {
+		for _, e := range entries {
+			if !recorded[fingerprint(e.Certificate)] && !isManaged(e) {
+				continue
+			}
+			key := string(e.Certificate.Raw)
+			if _, ok := found[key]; !ok {
+				certs = append(certs, e.Certificate)
+			}
+			if !containsString(found[key], trust) {
+				found[key] = append(found[key], trust)
+			}
+		}
+	}
+
+	for _, t := range o.sortedTrusts() {
+		if err := t.PreCheck(); err != nil {
+			debug(err.Error())
+			o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error()})
+			continue
+		}
+		l, ok := t.(Lister)
+		if !ok {
+			o.report(Result{Trust: t.Name(), Action: ActionSkipped, Reason: "listing certificates is not supported"})
+			continue
+		}
+		entries, err := l.List()
+		if err != nil {
+			o.report(Result{Trust: t.Name(), Action: ActionFailed, Err: err})
+			errs = append(errs, err)
+			continue
+		}
+		add(t.Name(), entries)
+	}
+
+	switch {
+	case o.withUserScope:
+		entries, err := pemFileEntries(userBundleFilename())
+		if err != nil {
+			o.report(Result{Trust: "user", Action: ActionFailed, Err: err})
+			errs = append(errs, err)
+			break
+		}
+		add("user", entries)
+	case o.withNoSystem:
+	default:
+		entries, err := listPlatform()
+		switch {
+		case err == ErrNotSupported:
+			o.report(Result{Trust: "system", Action: ActionSkipped, Reason: "listing certificates is not supported"})
+		case err != nil:
+			o.report(Result{Trust: "system", Action: ActionFailed, Err: err})
+			errs = append(errs, err)
+		default:
+			add("system", entries)
+		}
+	}
+
+	var stale []Stale
+	for _, cert := range certs {
+		if reason, ok := staleReason(cert, certs); ok {
+			stale = append(stale, Stale{
+				Certificate: cert,
+				Reason:      reason,
+				Trusts:      found[string(cert.Raw)],
+			})
+		}
+	}
+	if o.dryRun {
+		return stale, joinErrors(errs)
+	}
+
+	// Uninstall reports the failures and continues with the other
+	// truststores, the other certificates are also uninstalled.
+	for _, s := range stale {
+		debug("pruning %s certificate %s", s.Reason, uniqueName(s.Certificate))
+		if err := Uninstall(s.Certificate, opts...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stale, joinErrors(errs)
+}
+
+// staleReason returns if the certificate is expired or superseded by one of
+// the given certificates.
+func staleReason(cert *x509.Certificate, certs []*x509.Certificate) (PruneReason, bool) {
+	now := time.Now()
+	if now.After(cert.NotAfter) {
+		return PruneExpired, true
+	}
+	for _, c := range certs {
+		if c.Equal(cert) || now.After(c.NotAfter) || !c.NotBefore.After(cert.NotBefore) {
+			continue
+		}
+		if bytes.Equal(c.RawSubject, cert.RawSubject) || bytes.Equal(c.RawSubjectPublicKeyInfo, cert.RawSubjectPublicKeyInfo) {
+			return PruneSuperseded, true
+		}
+	}
+	return "", false
+}
+
+// isManaged returns if the entry has the name given by truststore to its
+// certificate. The names are case insensitive as Java lowercases the aliases.
+func isManaged(e Entry) bool {
+	name := uniqueName(e.Certificate)
+	return strings.EqualFold(e.Name, name) || strings.EqualFold(e.Name, strings.ReplaceAll(name, " ", "_"))
+}
+
+// listCertificateFiles returns the certificates in the files matching the
+// given pattern, named after the file without the extension. The files that
+// cannot be parsed are ignored.
+func listCertificateFiles(pattern string) []Entry {
+	files, _ := filepath.Glob(pattern)
+	var entries []Entry
+	for _, filename := range files {
+		cert, err := ReadCertificate(filename)
+		if err != nil {
+			continue
+		}
+		base := filepath.Base(filename)
+		entries = append(entries, Entry{
+			Name:        strings.TrimSuffix(base, filepath.Ext(base)),
+			Certificate: cert,
+		})
+	}
+	return entries
+}
+
+// parseCertificates returns all the certificates in the given PEM data.
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// appendEntry appends the entry if it is not already in the list.
+func appendEntry(entries []Entry, e Entry) []Entry {
+	for _, entry := range entries {
+		if entry.Name == e.Name && entry.Certificate.Equal(e.Certificate) {
+			return entries
+		}
+	}
+	return append(entries, e)
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// PythonTrust implements a Trust for Python. Python requests uses the certifi
+// bundle instead of the system truststore, PythonTrust adds the certificate to
+// the certifi bundles of the interpreters and virtual environments found or,
+// alternatively, maintains a bundle and exports REQUESTS_CA_BUNDLE with it.
+type PythonTrust struct {
+	bundles []string
+	env     *caBundle
+}
+
+// NewPythonTrust creates a new PythonTrust that adds the certificate to the
+// certifi bundles of the Python interpreters and virtual environments found.
+func NewPythonTrust() (*PythonTrust, error) {
+	interpreters := pythonInterpreters()
+	if len(interpreters) == 0 {
+		return nil, trustNotFound("python not found in PATH or in virtual environments")
+	}
+	return &PythonTrust{
+		bundles: certifiBundles(interpreters),
+	}, nil
+}
+
+// NewPythonEnvTrust creates a new PythonTrust that maintains a bundle with the
+// system roots and the installed certificates, and an environment snippet that
+// exports REQUESTS_CA_BUNDLE with it.
+func NewPythonEnvTrust() (*PythonTrust, error) {
+	if len(pythonInterpreters()) == 0 {
+		return nil, trustNotFound("python not found in PATH or in virtual environments")
+	}
+	return &PythonTrust{
+		env: &caBundle{
+			path:        filepath.Join(userDataDir(), "python-ca-bundle.pem"),
+			systemRoots: true,
+		},
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *PythonTrust) Name() string {
+	if t != nil && t.env != nil {
+		return "python-env"
+	}
+	return "python"
+}
+
+// Install implements the Trust interface.
+func (t *PythonTrust) Install(_ string, cert *x509.Certificate) error {
+	if t.env != nil {
+		if err := t.env.add(cert); err != nil {
+			return wrapError(err, "failed to write "+t.env.path)
+		}
+		if err := writeEnvSnippet(t.Name(), []envVar{
+			{"REQUESTS_CA_BUNDLE", t.env.path},
+		}); err != nil {
+			return err
+		}
+		debug("certificate installed properly in %s", t.env.path)
+		return nil
+	}
+
+	for _, filename := range t.bundles {
+		if err := addToPEMFile(filename, cert); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate installed properly in %s", filename)
+	}
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *PythonTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	if t.env != nil {
+		empty, err := t.env.remove(cert)
+		if err != nil {
+			return wrapError(err, "failed to write "+t.env.path)
+		}
+		if empty {
+			if err := removeEnvSnippet(t.Name()); err != nil {
+				return err
+			}
+		}
+		debug("certificate uninstalled properly from %s", t.env.path)
+		return nil
+	}
+
+	for _, filename := range t.bundles {
+		if err := removeFromPEMFile(filename, cert); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate uninstalled properly from %s", filename)
+	}
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in all the certifi bundles or in the REQUESTS_CA_BUNDLE bundle.
+func (t *PythonTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	if t.env != nil {
+		return t.env.contains(cert)
+	}
+	if len(t.bundles) == 0 {
+		return false
+	}
+	for _, filename := range t.bundles {
+		if !pemFileContains(filename, cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// List implements the Lister interface.
+func (t *PythonTrust) List() ([]Entry, error) {
+	if t.env != nil {
+		return t.env.entries(), nil
+	}
+	var entries []Entry
+	for _, filename := range t.bundles {
+		list, err := pemFileEntries(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			entries = appendEntry(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *PythonTrust) PreCheck() error {
+	switch {
+	case t == nil:
+		return fmt.Errorf(`warning: "python" is not available, install Python to use the Python trust`)
+	case t.env == nil && len(t.bundles) == 0:
+		return fmt.Errorf("no writable certifi bundles found")
+	default:
+		return nil
+	}
+}
+
+// paths implements the pathTrust interface.
+func (t *PythonTrust) paths(_ *x509.Certificate) []string {
+	if t.env != nil {
+		return append([]string{t.env.path}, envSnippetPaths(t.Name())...)
+	}
+	return t.bundles
+}
+
+// pythonInterpreters returns the Python interpreters in the PATH, the active
+// virtual environment and the environments managed by virtualenvwrapper,
+// pyenv and conda.
+func pythonInterpreters() []string {
+	var paths []string
+	for _, name := range []string{"python3", "python"} {
+		if p, err := exec.LookPath(name); err == nil {
+			paths = append(paths, p)
+		}
+	}
+
+	bin := "bin"
+	if runtime.GOOS == "windows" {
+		bin = "Scripts"
+	}
+	var globs []string
+	for _, env := range []string{"VIRTUAL_ENV", "CONDA_PREFIX"} {
+		if dir := os.Getenv(env); dir != "" {
+			globs = append(globs, filepath.Join(dir, bin, "python*"))
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		globs = append(globs,
+			filepath.Join(home, ".virtualenvs", "*", bin, "python*"),
+			filepath.Join(home, ".pyenv", "versions", "*", bin, "python*"),
+		)
+	}
+	globs = append(globs,
+		filepath.Join(".venv", bin, "python*"),
+		filepath.Join("venv", bin, "python*"),
+	)
+	for _, glob := range globs {
+		matches, _ := filepath.Glob(glob)
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 && !strings.Contains(filepath.Base(m), "-") {
+				paths = append(paths, m)
+			}
+		}
+	}
+
+	// The interpreter of a virtual environment is usually a link to the base
+	// interpreter, the links are not resolved to keep the environment.
+	var unique []string
+	for _, p := range paths {
+		if p, err := filepath.Abs(p); err == nil && !containsString(unique, p) {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// certifiBundles returns the writable certifi bundles used by the given
+// interpreters. If an interpreter fails to import certifi, the bundle is
+// searched in its site-packages.
+func certifiBundles(interpreters []string) []string {
+	var bundles []string
+	for _, python := range interpreters {
+		//nolint:gosec // tolerable risk necessary for function
+		cmd := exec.Command(python, "-c", "import certifi; print(certifi.where())")
+		if out, err := cmd.Output(); err == nil {
+			bundles = append(bundles, strings.TrimSpace(string(out)))
+			continue
+		}
+		prefix := filepath.Dir(filepath.Dir(python))
+		for _, glob := range []string{
+			filepath.Join(prefix, "lib", "python*", "site-packages", "certifi", "cacert.pem"),
+			filepath.Join(prefix, "Lib", "site-packages", "certifi", "cacert.pem"),
+		} {
+			matches, _ := filepath.Glob(glob)
+			bundles = append(bundles, matches...)
+		}
+	}
+
+	// Distributions can patch certifi to use the system bundle, this one is
+	// skipped as well as the bundles that cannot be modified.
+	system := uniquePaths(SystemBundleFiles)
+	var writable []string
+	for _, filename := range uniquePaths(bundles) {
+		if containsString(system, filename) {
+			debug("skipping certifi bundle %s, it is the system bundle", filename)
+			continue
+		}
+		if !isWritable(filename) {
+			debug("skipping certifi bundle %s, it is not writable", filename)
+			continue
+		}
+		writable = append(writable, filename)
+	}
+	return writable
+}
+
+// uniquePaths resolves the symbolic links of the given paths and returns the
+// ones that exist without duplicates.
+func uniquePaths(paths []string) []string {
+	var unique []string
+	for _, p := range paths {
+		p, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			continue
+		}
+		if !containsString(unique, p) {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// RegistryCertDirs are the directories where Docker, containerd and Podman
+// look for the certificates of a registry. The rootless Podman directory,
+// ~/.config/containers/certs.d, is added if Podman is installed.
+var RegistryCertDirs = map[string]string{
+	"docker":     "/etc/docker/certs.d",
+	"containerd": "/etc/containerd/certs.d",
+	"podman":     "/etc/containers/certs.d",
+}
+
+// RegistryTrust implements a Trust for container registries. It installs the
+// certificate as a CA of the given registries in the certificate directories
+// of Docker, containerd and Podman.
+type RegistryTrust struct {
+	hosts []string
+	dirs  []string
+}
+
+// NewRegistryTrust creates a new RegistryTrust for the given registry hosts,
+// with an optional port, e.g. "registry.local:5000". It returns an error if
+// no container runtime is found.
+func NewRegistryTrust(hosts ...string) (*RegistryTrust, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrTrustNotSupported
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("registry trust requires at least one registry host")
+	}
+	for _, h := range hosts {
+		if h == "" || strings.ContainsAny(h, `/\`) || strings.HasPrefix(h, ".") {
+			return nil, fmt.Errorf("invalid registry host %q", h)
+		}
+	}
+
+	var dirs []string
+	for _, name := range []string{"docker", "containerd", "podman"} {
+		dir := RegistryCertDirs[name]
+		_, errPath := exec.LookPath(name)
+		_, errStat := os.Stat(filepath.Dir(dir))
+		if errPath == nil || errStat == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	if _, err := exec.LookPath("podman"); err == nil {
+		dirs = append(dirs, filepath.Join(userConfigDir(), "containers", "certs.d"))
+	}
+	if len(dirs) == 0 {
+		return nil, trustNotFound("docker, containerd or podman not found")
+	}
+
+	return &RegistryTrust{
+		hosts: hosts,
+		dirs:  dirs,
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *RegistryTrust) Name() string {
+	return "registry"
+}
+
+// Install implements the Trust interface.
+func (t *RegistryTrust) Install(_ string, cert *x509.Certificate) error {
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+	for _, filename := range t.filenames(cert) {
+		if err := writeFileAsRoot(filename, data, 0644); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate installed properly in %s", filename)
+	}
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *RegistryTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	for _, filename := range t.filenames(cert) {
+		if err := removeFileAsRoot(filename); err != nil {
+			return wrapError(err, "failed to remove "+filename)
+		}
+		// Remove the registry directory if it is empty.
+		dir := filepath.Dir(filename)
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := removeFileAsRoot(dir); err != nil {
+				debug("failed to remove %s: %v", dir, err)
+			}
+		}
+		debug("certificate uninstalled properly from %s", filename)
+	}
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// installed for all the registries.
+func (t *RegistryTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil {
+		return false
+	}
+	for _, filename := range t.filenames(cert) {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return false
+		}
+		block, _ := pem.Decode(b)
+		if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+			return false
+		}
+	}
+	return true
+}
+
+// List implements the Lister interface.
+func (t *RegistryTrust) List() ([]Entry, error) {
+	var entries []Entry
+	for _, dir := range t.dirs {
+		for _, host := range t.hosts {
+			for _, e := range listCertificateFiles(filepath.Join(dir, host, "*.crt")) {
+				entries = appendEntry(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *RegistryTrust) PreCheck() error {
+	if t != nil {
+		return nil
+	}
+	return fmt.Errorf("warning: Docker, containerd or Podman are not available, or no registry has been given")
+}
+
+// paths implements the pathTrust interface.
+func (t *RegistryTrust) paths(cert *x509.Certificate) []string {
+	return t.filenames(cert)
+}
+
+// filenames returns the certificate file of each registry in each of the
+// certificate directories. Any *.crt file is used as a CA, the name is unique
+// so existing certificates are not overwritten.
+func (t *RegistryTrust) filenames(cert *x509.Certificate) []string {
+	name := strings.ReplaceAll(uniqueName(cert), " ", "_") + ".crt"
+	var filenames []string
+	for _, dir := range t.dirs {
+		for _, host := range t.hosts {
+			filenames = append(filenames, filepath.Join(dir, host, name))
+		}
+	}
+	return filenames
+}
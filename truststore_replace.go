@@ -0,0 +1,124 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Replace rotates a root certificate. It installs the new certificate in all
+// the enabled truststores, verifies that it is installed, and only then
+// uninstalls the old certificate. If the install or the verification fail,
+// the old certificate is kept, so the truststores never end up without any
+// of them, and the new certificate is uninstalled from the truststores where
+// it was installed. The outcome on each truststore is sent to the reporter set
+// with WithReporter.
+func Replace(oldCert, newCert *x509.Certificate, opts ...Option) error {
+	if oldCert.Equal(newCert) {
+		return fmt.Errorf("the old and new certificates are the same")
+	}
+	// The truststores use the name to locate the certificates, the new
+	// certificate would replace the old one in some of them and be removed
+	// with it.
+	if uniqueName(oldCert) == uniqueName(newCert) {
+		return fmt.Errorf("the old and new certificates have the same name %q", uniqueName(newCert))
+	}
+
+	o := newOptions(opts)
+	newFile, fn, err := saveTempCert(newCert)
+	defer fn()
+	if err != nil {
+		return err
+	}
+
+	// Keep the truststores where the new certificate is installed, so the
+	// install can be rolled back.
+	var installed []string
+	installOpts := *o
+	installOpts.reporter = func(r Result) {
+		if r.Action == ActionInstalled {
+			installed = append(installed, r.Trust)
+		}
+		o.report(r)
+	}
+	if err := installCertificate(newFile, newCert, &installOpts); err != nil {
+		err = wrapError(err, "failed to install the new certificate, the old certificate was not uninstalled")
+		return rollbackInstall(newFile, newCert, installed, o, err)
+	}
+	if err := verifyCertificate(newCert, o); err != nil {
+		err = wrapError(err, "failed to verify the new certificate, the old certificate was not uninstalled")
+		return rollbackInstall(newFile, newCert, installed, o, err)
+	}
+
+	oldFile, fn, err := saveTempCert(oldCert)
+	defer fn()
+	if err != nil {
+		return err
+	}
+	if err := uninstallCertificate(oldFile, oldCert, o); err != nil {
+		return wrapError(err, "failed to uninstall the old certificate")
+	}
+	return nil
+}
+
+// verifyCertificate checks that the certificate is installed in all the
+// enabled truststores.
+func verifyCertificate(cert *x509.Certificate, o *options) error {
+	for _, t := range o.sortedTrusts() {
+		if err := t.PreCheck(); err != nil {
+			continue
+		}
+		if !t.Exists(cert) {
+			err := fmt.Errorf("certificate is not installed in the %s truststore", t.Name())
+			o.report(Result{Trust: t.Name(), Action: ActionFailed, Reason: "verification failed", Err: err, Certificate: cert})
+			return err
+		}
+	}
+
+	switch {
+	case o.withUserScope:
+		if !pemFileContains(userBundleFilename(), cert) {
+			err := fmt.Errorf("certificate is not installed in %s", userBundleFilename())
+			o.report(Result{Trust: "user", Action: ActionFailed, Reason: "verification failed", Err: err, Certificate: cert})
+			return err
+		}
+	case o.withNoSystem:
+	default:
+		if err := verifyPlatform(cert); err != nil {
+			err = wrapError(err, "certificate is not trusted by the system")
+			o.report(Result{Trust: "system", Action: ActionFailed, Reason: "verification failed", Err: err, Certificate: cert})
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackInstall uninstalls the certificate from the given truststores after
+// a failed install or verification, err. The truststores where it cannot be
+// uninstalled are reported, and the errors are returned in a MultiError.
+func rollbackInstall(filename string, cert *x509.Certificate, installed []string, o *options, err error) error {
+	if len(installed) == 0 {
+		return err
+	}
+	ro := *o
+	ro.backupDir = ""
+	ro.trusts = make(map[string]Trust)
+	for name, t := range o.trusts {
+		if containsString(installed, name) {
+			ro.trusts[name] = t
+		}
+	}
+	if !containsString(installed, "user") {
+		ro.withUserScope = false
+	}
+	if !containsString(installed, "system") {
+		ro.withNoSystem = true
+	}
+	debug("uninstalling the new certificate from %s", strings.Join(installed, ", "))
+	if rbErr := uninstallCertificate(filename, cert, &ro); rbErr != nil {
+		return &MultiError{Errors: []error{err, wrapError(rbErr, "failed to uninstall the new certificate")}}
+	}
+	return err
+}
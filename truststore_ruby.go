@@ -0,0 +1,139 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RubyTrust implements a Trust for Ruby. Rubies built with rbenv, ruby-build
+// or rvm use their own OpenSSL and certificate file, RubyTrust adds the
+// certificate to the ones owned by the user.
+type RubyTrust struct {
+	certFiles []string
+}
+
+// NewRubyTrust creates a new RubyTrust if Ruby is installed.
+func NewRubyTrust() (*RubyTrust, error) {
+	var rubies []string
+	if p, err := exec.LookPath("ruby"); err == nil {
+		rubies = append(rubies, p)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, glob := range []string{
+			filepath.Join(home, ".rbenv", "versions", "*", "bin", "ruby"),
+			filepath.Join(home, ".rubies", "*", "bin", "ruby"),
+			filepath.Join(home, ".rvm", "rubies", "*", "bin", "ruby"),
+		} {
+			matches, _ := filepath.Glob(glob)
+			rubies = append(rubies, matches...)
+		}
+	}
+	if len(rubies) == 0 {
+		return nil, trustNotFound("ruby not found in PATH, rbenv, chruby or rvm")
+	}
+
+	var certFiles []string
+	for _, ruby := range rubies {
+		//nolint:gosec // tolerable risk necessary for function
+		cmd := exec.Command(ruby, "-ropenssl", "-e", "print OpenSSL::X509::DEFAULT_CERT_FILE")
+		out, err := cmd.Output()
+		if err != nil {
+			debug("failed to execute \"%s\": %s", ruby, err)
+			continue
+		}
+		filename := strings.TrimSpace(string(out))
+		if p, err := filepath.EvalSymlinks(filename); err == nil {
+			filename = p
+		}
+		switch {
+		case containsString(certFiles, filename):
+		case containsString(uniquePaths(SystemBundleFiles), filename) || !isWritable(filename):
+			debug("skipping Ruby certificate file %s", filename)
+		default:
+			certFiles = append(certFiles, filename)
+		}
+	}
+
+	return &RubyTrust{
+		certFiles: certFiles,
+	}, nil
+}
+
+// Name implements the Trust interface.
+func (t *RubyTrust) Name() string {
+	return "ruby"
+}
+
+// Install implements the Trust interface.
+func (t *RubyTrust) Install(_ string, cert *x509.Certificate) error {
+	for _, filename := range t.certFiles {
+		if err := addToPEMFile(filename, cert); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate installed properly in %s", filename)
+	}
+	return nil
+}
+
+// Uninstall implements the Trust interface.
+func (t *RubyTrust) Uninstall(_ string, cert *x509.Certificate) error {
+	for _, filename := range t.certFiles {
+		if err := removeFromPEMFile(filename, cert); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("certificate uninstalled properly from %s", filename)
+	}
+	return nil
+}
+
+// Exists implements the Trust interface. Exists checks if the certificate is
+// in all the certificate files.
+func (t *RubyTrust) Exists(cert *x509.Certificate) bool {
+	if t == nil || len(t.certFiles) == 0 {
+		return false
+	}
+	for _, filename := range t.certFiles {
+		if !pemFileContains(filename, cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// List implements the Lister interface.
+func (t *RubyTrust) List() ([]Entry, error) {
+	var entries []Entry
+	for _, filename := range t.certFiles {
+		list, err := pemFileEntries(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			entries = appendEntry(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// PreCheck implements the Trust interface.
+func (t *RubyTrust) PreCheck() error {
+	switch {
+	case t == nil:
+		return fmt.Errorf(`warning: "ruby" is not available, install Ruby to use the Ruby trust`)
+	case len(t.certFiles) == 0:
+		return fmt.Errorf("no per-user Ruby OpenSSL certificate files found")
+	default:
+		return nil
+	}
+}
+
+// paths implements the pathTrust interface.
+func (t *RubyTrust) paths(cert *x509.Certificate) []string {
+	return t.certFiles
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+)
+
+// Status returns if the certificate is installed in each of the enabled
+// truststores, and in the system truststore or the per-user locations. The
+// results have the action ActionExists or ActionMissing, or ActionSkipped if
+// the truststore is not available.
+func Status(cert *x509.Certificate, opts ...Option) []Result {
+	o := newOptions(opts)
+	restore := useManagedName(cert)
+	defer restore()
+
+	var results []Result
+	for _, t := range o.sortedTrusts() {
+		if err := t.PreCheck(); err != nil {
+			results = append(results, Result{Trust: t.Name(), Action: ActionSkipped, Reason: err.Error(), Certificate: cert})
+			continue
+		}
+		r := Result{Trust: t.Name(), Action: ActionMissing, Certificate: cert}
+		if t.Exists(cert) {
+			r.Action = ActionExists
+		}
+		results = append(results, r)
+	}
+
+	switch {
+	case o.withUserScope:
+		r := Result{Trust: "user", Action: ActionMissing, Path: userBundleFilename(), Certificate: cert}
+		if pemFileContains(r.Path, cert) {
+			r.Action = ActionExists
+		}
+		results = append(results, r)
+	case o.withNoSystem:
+	default:
+		r := Result{Trust: "system", Action: ActionExists, Certificate: cert}
+		switch err := verifyPlatform(cert); err {
+		case nil:
+		case ErrNotSupported, ErrTrustNotSupported:
+			r.Action, r.Reason = ActionSkipped, "the system truststore is not supported"
+		default:
+			r.Action, r.Err = ActionMissing, err
+		}
+		results = append(results, r)
+	}
+
+	for _, r := range results {
+		o.report(r)
+	}
+	return results
+}
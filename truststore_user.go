@@ -0,0 +1,126 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userDataDir returns the directory where truststore keeps the per-user data,
+// $XDG_DATA_HOME/truststore or ~/.local/share/truststore.
+func userDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "truststore")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "truststore")
+}
+
+// userConfigDir returns $XDG_CONFIG_HOME or ~/.config.
+func userConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config")
+}
+
+func userBundleFilename() string {
+	return filepath.Join(userDataDir(), "ca-bundle.pem")
+}
+
+func installUserScope(cert *x509.Certificate) error {
+	bundle := &caBundle{path: userBundleFilename(), systemRoots: true}
+	if err := bundle.add(cert); err != nil {
+		return wrapError(err, "failed to write "+bundle.path)
+	}
+
+	if err := writeEnvSnippet("user", []envVar{
+		{"SSL_CERT_FILE", bundle.path},
+		{"REQUESTS_CA_BUNDLE", bundle.path},
+		{"NODE_EXTRA_CA_CERTS", bundle.path},
+	}); err != nil {
+		return err
+	}
+
+	debug("certificate installed properly in %s", bundle.path)
+	return nil
+}
+
+func uninstallUserScope(cert *x509.Certificate) error {
+	bundle := &caBundle{path: userBundleFilename(), systemRoots: true}
+	empty, err := bundle.remove(cert)
+	if err != nil {
+		return wrapError(err, "failed to write "+bundle.path)
+	}
+	if empty {
+		if err := removeEnvSnippet("user"); err != nil {
+			return err
+		}
+	}
+
+	debug("certificate uninstalled properly from %s", bundle.path)
+	return nil
+}
+
+type envVar struct {
+	name  string
+	value string
+}
+
+// envSnippetFilenames returns the shell and the systemd environment.d snippets
+// with the given name.
+func envSnippetFilenames(name string) (string, string) {
+	return filepath.Join(userDataDir(), "env.d", name+".sh"),
+		filepath.Join(userConfigDir(), "environment.d", "60-truststore-"+name+".conf")
+}
+
+// envSnippetPaths returns the snippets with the given name as a list, for the
+// paths of the trusts that write them.
+func envSnippetPaths(name string) []string {
+	shFilename, confFilename := envSnippetFilenames(name)
+	return []string{shFilename, confFilename}
+}
+
+// writeEnvSnippet writes a shell snippet that can be sourced from the shell
+// profile and a systemd environment.d snippet with the given variables.
+func writeEnvSnippet(name string, vars []envVar) error {
+	var sh, conf strings.Builder
+	sh.WriteString(bundleHeader)
+	conf.WriteString(bundleHeader)
+	for _, v := range vars {
+		fmt.Fprintf(&sh, "export %s=%q\n", v.name, v.value)
+		fmt.Fprintf(&conf, "%s=%s\n", v.name, v.value)
+	}
+
+	shFilename, confFilename := envSnippetFilenames(name)
+	for filename, data := range map[string]string{
+		shFilename:   sh.String(),
+		confFilename: conf.String(),
+	} {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		//nolint:gosec // the snippet does not contain secrets
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			return wrapError(err, "failed to write "+filename)
+		}
+		debug("environment written to %s", filename)
+	}
+	return nil
+}
+
+// removeEnvSnippet removes the snippets created by writeEnvSnippet.
+func removeEnvSnippet(name string) error {
+	shFilename, confFilename := envSnippetFilenames(name)
+	for _, filename := range []string{shFilename, confFilename} {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
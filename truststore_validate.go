@@ -0,0 +1,209 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Severity is the severity of a validation issue.
+type Severity int
+
+const (
+	// SeverityWarning indicates an issue that does not prevent the install.
+	SeverityWarning Severity = iota
+	// SeverityError indicates an issue that prevents the install.
+	SeverityError
+)
+
+// String implements the fmt.Stringer interface.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// IssueCode identifies the kind of a validation issue.
+type IssueCode string
+
+const (
+	// IssueNotCA indicates that the certificate does not have the basic
+	// constraints CA:TRUE.
+	IssueNotCA IssueCode = "not-ca"
+	// IssueNoKeyUsage indicates that the certificate does not have the key
+	// usage extension.
+	IssueNoKeyUsage IssueCode = "no-key-usage"
+	// IssueNoCertSign indicates that the key usage does not allow signing
+	// certificates.
+	IssueNoCertSign IssueCode = "no-cert-sign"
+	// IssueExpired indicates that the certificate has expired.
+	IssueExpired IssueCode = "expired"
+	// IssueNotYetValid indicates that the certificate is not valid yet.
+	IssueNotYetValid IssueCode = "not-yet-valid"
+	// IssueExpiresSoon indicates that the certificate expires in less than
+	// 30 days.
+	IssueExpiresSoon IssueCode = "expires-soon"
+	// IssueWeakKey indicates that the key is too small.
+	IssueWeakKey IssueCode = "weak-key"
+	// IssueWeakSignature indicates that the signature algorithm is not secure.
+	IssueWeakSignature IssueCode = "weak-signature"
+	// IssueNoNameConstraints indicates that the CA can sign certificates for
+	// any name.
+	IssueNoNameConstraints IssueCode = "no-name-constraints"
+	// IssueNameConstraintsNotCritical indicates that the name constraints are
+	// not marked as critical, and they might be ignored.
+	IssueNameConstraintsNotCritical IssueCode = "name-constraints-not-critical"
+	// IssueNameConstraintsRequired indicates that the certificate does not
+	// have permitted DNS domains and they are required by
+	// WithRequireNameConstraints.
+	IssueNameConstraintsRequired IssueCode = "name-constraints-required"
+	// IssueNameConstraintsNotAllowed indicates that a permitted DNS domain is
+	// not in the domains allowed by WithRequireNameConstraints.
+	IssueNameConstraintsNotAllowed IssueCode = "name-constraints-not-allowed"
+)
+
+// expiresSoon is the time before the expiration of a certificate in which
+// Validate warns about it.
+const expiresSoon = 30 * 24 * time.Hour
+
+// Issue is a problem found in a certificate by Validate.
+type Issue struct {
+	Code     IssueCode
+	Severity Severity
+	Message  string
+}
+
+// String implements the fmt.Stringer interface.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+}
+
+// Validate checks if the certificate is suitable to be installed as a root
+// certificate. It returns the issues found, the ones with SeverityError
+// prevent the certificate from being installed, unless WithNoValidation is
+// used. The only options used are the validation policies, like
+// WithRequireNameConstraints.
+func Validate(cert *x509.Certificate, opts ...Option) []Issue {
+	return validate(cert, newOptions(opts))
+}
+
+func validate(cert *x509.Certificate, o *options) []Issue {
+	var issues []Issue
+	add := func(code IssueCode, severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{
+			Code:     code,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		add(IssueNotCA, SeverityError, "certificate is not a CA, it does not have basic constraints CA:TRUE")
+	}
+	switch {
+	case cert.KeyUsage == 0:
+		add(IssueNoKeyUsage, SeverityWarning, "certificate does not have the key usage extension")
+	case cert.KeyUsage&x509.KeyUsageCertSign == 0:
+		add(IssueNoCertSign, SeverityError, "certificate key usage does not include certificate signing")
+	}
+
+	now := time.Now()
+	switch {
+	case now.After(cert.NotAfter):
+		add(IssueExpired, SeverityError, "certificate expired on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	case now.Before(cert.NotBefore):
+		add(IssueNotYetValid, SeverityError, "certificate is not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))
+	case cert.NotAfter.Sub(now) < expiresSoon:
+		add(IssueExpiresSoon, SeverityWarning, "certificate expires on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if n := k.N.BitLen(); n < 2048 {
+			add(IssueWeakKey, SeverityError, "RSA key size is %d bits, at least 2048 bits are required", n)
+		}
+	case *ecdsa.PublicKey:
+		if n := k.Curve.Params().BitSize; n < 256 {
+			add(IssueWeakKey, SeverityError, "ECDSA key size is %d bits, at least 256 bits are required", n)
+		}
+	}
+
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		add(IssueWeakSignature, SeverityError, "signature algorithm %s is not secure", cert.SignatureAlgorithm)
+	}
+
+	switch {
+	case o.requireNameConstraints && len(cert.PermittedDNSDomains) == 0:
+		add(IssueNameConstraintsRequired, SeverityError, "certificate does not have permitted DNS domains in its name constraints, and they are required")
+	case o.requireNameConstraints:
+		for _, domain := range cert.PermittedDNSDomains {
+			if !domainAllowed(domain, o.allowedDomains) {
+				add(IssueNameConstraintsNotAllowed, SeverityError, "permitted DNS domain %q is not in the allowed domains %s", domain, strings.Join(o.allowedDomains, ", "))
+			}
+		}
+	case !hasNameConstraints(cert):
+		add(IssueNoNameConstraints, SeverityWarning, "certificate does not have name constraints, it can sign certificates for any name")
+	}
+	if hasNameConstraints(cert) && !cert.PermittedDNSDomainsCritical {
+		add(IssueNameConstraintsNotCritical, SeverityWarning, "name constraints are not critical, some clients might ignore them")
+	}
+
+	return issues
+}
+
+// domainAllowed returns if the names permitted by a DNS name constraint are
+// within the allowed domains. A domain with a leading period only matches its
+// subdomains, as in the name constraints.
+func domainAllowed(domain string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	domain = strings.ToLower(domain)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if strings.HasPrefix(a, ".") {
+			if strings.HasSuffix(domain, a) {
+				return true
+			}
+		} else if domain == a || domain == "."+a || strings.HasSuffix(domain, "."+a) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNameConstraints(cert *x509.Certificate) bool {
+	return len(cert.PermittedDNSDomains) > 0 || len(cert.ExcludedDNSDomains) > 0 ||
+		len(cert.PermittedIPRanges) > 0 || len(cert.ExcludedIPRanges) > 0 ||
+		len(cert.PermittedEmailAddresses) > 0 || len(cert.ExcludedEmailAddresses) > 0 ||
+		len(cert.PermittedURIDomains) > 0 || len(cert.ExcludedURIDomains) > 0
+}
+
+// validateCertificate runs Validate and returns a ValidationError if any of
+// the issues is an error. WithNoValidation ignores all the errors but the ones
+// of the policies explicitly required.
+func validateCertificate(cert *x509.Certificate, o *options) error {
+	issues := validate(cert, o)
+	for _, issue := range issues {
+		if issue.Severity != SeverityError {
+			continue
+		}
+		switch {
+		case !o.withNoValidation:
+			return &ValidationError{Issues: issues}
+		case issue.Code == IssueNameConstraintsRequired, issue.Code == IssueNameConstraintsNotAllowed:
+			return &ValidationError{Issues: issues}
+		}
+	}
+	for _, issue := range issues {
+		debug("%s", issue)
+	}
+	return nil
+}
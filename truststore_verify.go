@@ -0,0 +1,333 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// verifyJavaClass is the Java client used by Verify, it is run in
+// source-file mode and requires Java 11 or newer. It exits with status 3 if
+// the server certificate is not trusted.
+const verifyJavaClass = `import java.net.URL;
+import javax.net.ssl.HttpsURLConnection;
+import javax.net.ssl.SSLHandshakeException;
+
+public class TruststoreVerify {
+    public static void main(String[] args) throws Exception {
+        HttpsURLConnection conn = (HttpsURLConnection) new URL(args[0]).openConnection();
+        try {
+            conn.connect();
+        } catch (SSLHandshakeException e) {
+            System.err.println(e.getMessage());
+            System.exit(3);
+        }
+        conn.disconnect();
+    }
+}
+`
+
+// verifyServer is the local TLS server used by Verify.
+type verifyServer struct {
+	host, port string
+	chain      []*x509.Certificate
+}
+
+func (s *verifyServer) url() string {
+	return "https://localhost:" + s.port + "/"
+}
+
+// Verify checks that the clients actually trust the certificate. It starts a
+// TLS server on the loopback interface and performs a handshake with each of
+// the clients available: Go with the system certificate pool, curl, openssl
+// s_client and Java; and checks the chain with vfychain in the NSS security
+// databases. The server uses a throwaway leaf certificate issued with the key
+// set by WithVerifyKey, or the leaf certificate set by WithVerifyLeaf.
+//
+// The results have the client as the truststore name and the action
+// ActionTrusted or ActionNotTrusted, ActionSkipped if the client is not
+// available, or ActionFailed if the handshake could not be performed. They are
+// also sent to the reporter set with WithReporter.
+func Verify(cert *x509.Certificate, opts ...Option) ([]Result, error) {
+	o := newOptions(opts)
+
+	var leaf tls.Certificate
+	switch {
+	case o.verifyLeaf != nil:
+		leaf = *o.verifyLeaf
+	case o.verifyKey != nil:
+		var err error
+		if leaf, err = issueLeaf(cert, o.verifyKey); err != nil {
+			return nil, wrapError(err, "failed to issue the leaf certificate")
+		}
+	default:
+		return nil, fmt.Errorf("the certificate key or a leaf certificate is required")
+	}
+
+	s := &verifyServer{}
+	for _, der := range leaf.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, wrapError(err, "error parsing the leaf certificate")
+		}
+		s.chain = append(s.chain, c)
+	}
+	if len(s.chain) == 0 {
+		return nil, fmt.Errorf("the leaf certificate is empty")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, wrapError(err, "failed to start the TLS server")
+	}
+	srv := &http.Server{
+		Handler:  http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	//nolint:gosec // the clients decide the TLS version
+	go srv.Serve(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{leaf}}))
+	defer srv.Close()
+	s.host, s.port, _ = net.SplitHostPort(ln.Addr().String())
+	debug("verification server listening on %s", ln.Addr())
+
+	results := []Result{
+		verifyGo(s),
+		verifyCurl(s),
+		verifyOpenSSL(s),
+		verifyJava(s),
+	}
+	results = append(results, verifyNSS(s)...)
+	for i := range results {
+		results[i].Certificate = cert
+		o.report(results[i])
+	}
+	return results, nil
+}
+
+// issueLeaf issues a short lived certificate for localhost with the given CA.
+func issueLeaf(ca *x509.Certificate, caKey crypto.Signer) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	notAfter := now.Add(time.Hour)
+	if ca.NotAfter.Before(notAfter) {
+		notAfter = ca.NotAfter
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, key.Public(), caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// verifyGo performs a handshake using the system certificate pool.
+func verifyGo(s *verifyServer) Result {
+	r := Result{Trust: "go"}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		r.Action, r.Reason = ActionSkipped, "the system certificate pool is not available"
+		return r
+	}
+	conn, err := tls.Dial("tcp", net.JoinHostPort(s.host, s.port), &tls.Config{
+		RootCAs:    pool,
+		ServerName: "localhost",
+		MinVersion: tls.VersionTLS12,
+	})
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	switch {
+	case err == nil:
+		conn.Close()
+		r.Action = ActionTrusted
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalid), errors.As(err, &hostname):
+		r.Action, r.Err = ActionNotTrusted, err
+	default:
+		r.Action, r.Err = ActionFailed, err
+	}
+	return r
+}
+
+// verifyCurl performs a handshake with curl.
+func verifyCurl(s *verifyServer) Result {
+	r := Result{Trust: "curl"}
+	curlPath, err := exec.LookPath("curl")
+	if err != nil {
+		r.Action, r.Reason = ActionSkipped, "curl not found"
+		return r
+	}
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(curlPath, "-sS", "-o", os.DevNull,
+		"--resolve", "localhost:"+s.port+":"+s.host, s.url())
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		r.Action = ActionTrusted
+	// 60 is CURLE_PEER_FAILED_VERIFICATION
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 60:
+		r.Action, r.Err = ActionNotTrusted, NewCmdError(err, cmd, out)
+	default:
+		r.Action, r.Err = ActionFailed, NewCmdError(err, cmd, out)
+	}
+	return r
+}
+
+// verifyOpenSSL performs a handshake with openssl s_client.
+func verifyOpenSSL(s *verifyServer) Result {
+	r := Result{Trust: "openssl"}
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		r.Action, r.Reason = ActionSkipped, "openssl not found"
+		return r
+	}
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(opensslPath, "s_client", "-connect", net.JoinHostPort(s.host, s.port),
+		"-servername", "localhost", "-verify_hostname", "localhost", "-verify_return_error")
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err == nil && bytes.Contains(out, []byte("Verify return code: 0 (ok)")):
+		r.Action = ActionTrusted
+	case bytes.Contains(out, []byte("verify error")):
+		r.Action, r.Err = ActionNotTrusted, NewCmdError(errors.New("certificate verify failed"), cmd, out)
+	default:
+		if err == nil {
+			err = errors.New("unexpected output")
+		}
+		r.Action, r.Err = ActionFailed, NewCmdError(err, cmd, out)
+	}
+	return r
+}
+
+// verifyJava performs a handshake with the Java runtime in JAVA_HOME or in
+// the PATH.
+func verifyJava(s *verifyServer) Result {
+	r := Result{Trust: "java"}
+	javaPath, err := exec.LookPath("java")
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		javaPath = filepath.Join(home, "bin", "java")
+		if runtime.GOOS == "windows" {
+			javaPath += ".exe"
+		}
+		_, err = os.Stat(javaPath)
+	}
+	if err != nil {
+		r.Action, r.Reason = ActionSkipped, "java not found"
+		return r
+	}
+
+	dir, err := os.MkdirTemp(os.TempDir(), "truststore")
+	if err != nil {
+		r.Action, r.Err = ActionFailed, err
+		return r
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "TruststoreVerify.java")
+	if err := os.WriteFile(filename, []byte(verifyJavaClass), 0600); err != nil {
+		r.Action, r.Err = ActionFailed, err
+		return r
+	}
+
+	//nolint:gosec // tolerable risk necessary for function
+	cmd := exec.Command(javaPath, filename, s.url())
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		r.Action = ActionTrusted
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 3:
+		r.Action, r.Err = ActionNotTrusted, NewCmdError(err, cmd, out)
+	default:
+		r.Action, r.Err = ActionFailed, NewCmdError(err, cmd, out)
+	}
+	return r
+}
+
+// verifyNSS verifies the chain of the server with vfychain in each NSS
+// security database. NSS does not have a command line client that uses the
+// databases, so no handshake is performed.
+func verifyNSS(s *verifyServer) []Result {
+	t, err := NewNSSTrust()
+	if err != nil {
+		return []Result{{Trust: "nss", Action: ActionSkipped, Reason: "certutil not found"}}
+	}
+	vfychainPath := filepath.Join(filepath.Dir(t.certutilPath), "vfychain")
+	if _, err := os.Stat(vfychainPath); err != nil {
+		if vfychainPath, err = exec.LookPath("vfychain"); err != nil {
+			return []Result{{Trust: "nss", Action: ActionSkipped, Reason: "vfychain not found"}}
+		}
+	}
+
+	args := []string{"-u", "1", "-a"}
+	for _, c := range s.chain {
+		filename, fn, err := saveTempCert(c)
+		defer fn()
+		if err != nil {
+			return []Result{{Trust: "nss", Action: ActionFailed, Err: err}}
+		}
+		args = append(args, filename)
+	}
+
+	var results []Result
+	found := t.forEachProfile(func(profile string) {
+		r := Result{Trust: "nss", Path: profile[strings.Index(profile, ":")+1:]}
+		//nolint:gosec // tolerable risk necessary for function
+		cmd := exec.Command(vfychainPath, append([]string{"-d", profile}, args...)...)
+		out, err := cmd.CombinedOutput()
+		switch {
+		case bytes.Contains(out, []byte("Chain is good!")):
+			r.Action = ActionTrusted
+		case bytes.Contains(out, []byte("Chain is bad!")):
+			r.Action, r.Err = ActionNotTrusted, NewCmdError(errors.New("chain is bad"), cmd, out)
+		default:
+			if err == nil {
+				err = errors.New("unexpected output")
+			}
+			r.Action, r.Err = ActionFailed, NewCmdError(err, cmd, out)
+		}
+		results = append(results, r)
+	})
+	if found == 0 {
+		return []Result{{Trust: "nss", Action: ActionSkipped, Reason: "no security databases found"}}
+	}
+	return results
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchDelay is the time without file system events that the Watcher waits
+// before looking for new stores, so they are complete when the certificates
+// are installed.
+const watchDelay = 2 * time.Second
+
+// Watcher installs certificates into the NSS security databases and the Java
+// keystores created after it starts, like the ones of a new Firefox profile or
+// of a JDK installed with SDKMAN. The existing stores are not modified.
+//
+// The Watcher is only supported on Linux, where it uses inotify.
+type Watcher struct {
+	// NSSDirs are the directories with NSS security databases in their
+	// subdirectories, by default the parent of NSSProfile and ~/.pki.
+	NSSDirs []string
+	// JavaDirs are the directories where JDKs are installed, each JDK in a
+	// subdirectory. By default SDKMAN, asdf, IntelliJ IDEA, /usr/lib/jvm and
+	// the parent of JAVA_HOME.
+	JavaDirs []string
+
+	certs []*x509.Certificate
+	opts  []Option
+	known map[string]bool
+}
+
+// NewWatcher creates a Watcher that installs the given certificates. The
+// options are used as in Install, but only the new stores are modified.
+func NewWatcher(certs []*x509.Certificate, opts ...Option) *Watcher {
+	home := os.Getenv("HOME")
+	w := &Watcher{
+		NSSDirs: []string{filepath.Dir(nssDB)},
+		JavaDirs: []string{
+			filepath.Join(home, ".sdkman", "candidates", "java"),
+			filepath.Join(home, ".asdf", "installs", "java"),
+			filepath.Join(home, ".jdks"),
+			"/usr/lib/jvm",
+		},
+		certs: certs,
+		opts:  opts,
+	}
+	if NSSProfile != "" {
+		w.NSSDirs = append([]string{filepath.Dir(NSSProfile)}, w.NSSDirs...)
+	}
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		if dir := filepath.Dir(filepath.Clean(javaHome)); !containsString(w.JavaDirs, dir) {
+			w.JavaDirs = append(w.JavaDirs, dir)
+		}
+	}
+	return w
+}
+
+// stores returns the NSS security databases, as the directories with a
+// cert9.db, and the Java keystores in the watched directories. The paths have
+// the symbolic links resolved.
+func (w *Watcher) stores() (nss, java []string) {
+	var patterns []string
+	for _, dir := range w.NSSDirs {
+		patterns = append(patterns, filepath.Join(dir, "*", "cert9.db"))
+	}
+	for _, dir := range w.JavaDirs {
+		patterns = append(patterns,
+			filepath.Join(dir, "*", "lib", "security", "cacerts"),
+			filepath.Join(dir, "*", "jre", "lib", "security", "cacerts"))
+	}
+
+	seen := make(map[string]bool)
+	for i, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			p, err := filepath.EvalSymlinks(m)
+			if err == nil {
+				p, err = filepath.Abs(p)
+			}
+			if err == nil && !seen[p] {
+				seen[p] = true
+				if i < len(w.NSSDirs) {
+					nss = append(nss, filepath.Dir(p))
+				} else {
+					java = append(java, p)
+				}
+			}
+		}
+	}
+	return nss, java
+}
+
+// scan installs the certificates in the stores created since the last scan.
+// The first scan only records the existing stores.
+func (w *Watcher) scan() {
+	first := w.known == nil
+	if first {
+		w.known = make(map[string]bool)
+	}
+
+	nss, java := w.stores()
+	var trusts []Trust
+	for _, dir := range nss {
+		if !w.known[dir] {
+			w.known[dir] = true
+			if first {
+				continue
+			}
+			debug("found new NSS security database in %s", dir)
+			if t, err := NewNSSProfileTrust(dir); err == nil {
+				trusts = append(trusts, t)
+			} else {
+				w.report(Result{Trust: "nss", Action: ActionSkipped, Path: dir, Reason: err.Error()})
+			}
+		}
+	}
+	for _, keystore := range java {
+		if !w.known[keystore] {
+			w.known[keystore] = true
+			if first {
+				continue
+			}
+			debug("found new Java keystore %s", keystore)
+			if t, err := NewJavaKeystoreTrust(keystore); err == nil {
+				trusts = append(trusts, t)
+			} else {
+				w.report(Result{Trust: "java:" + keystore, Action: ActionSkipped, Path: keystore, Reason: err.Error()})
+			}
+		}
+	}
+
+	for _, t := range trusts {
+		o := newOptions(w.opts)
+		o.trusts = map[string]Trust{t.Name(): t}
+		o.withNoSystem = true
+		o.withUserScope = false
+		// installCertificate reports the failures of the trust, the others,
+		// e.g. a certificate that is not valid, are reported here.
+		var reported bool
+		reporter := o.reporter
+		o.reporter = func(r Result) {
+			if r.Action == ActionFailed {
+				reported = true
+			}
+			if reporter != nil {
+				reporter(r)
+			}
+		}
+		for _, cert := range w.certs {
+			reported = false
+			filename, fn, err := saveTempCert(cert)
+			if err == nil {
+				err = installCertificate(filename, cert, o)
+			}
+			fn()
+			if err != nil {
+				debug("failed to install %s in %s: %v", uniqueName(cert), t.Name(), err)
+				if !reported {
+					w.report(Result{Trust: t.Name(), Action: ActionFailed, Err: err, Path: firstPath(trustPaths(t, cert)), Certificate: cert})
+				}
+			}
+		}
+	}
+}
+
+func (w *Watcher) report(r Result) {
+	newOptions(w.opts).report(r)
+}
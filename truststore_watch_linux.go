@@ -0,0 +1,130 @@
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchEvents are the inotify events that can add a store.
+const watchEvents = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+
+// inotifyEvent is an inotify event with the name of the file.
+type inotifyEvent struct {
+	wd   int32
+	mask uint32
+	name string
+}
+
+// watchedDir is a directory watched with inotify, depth is the number of
+// subdirectory levels that are also watched.
+type watchedDir struct {
+	path  string
+	depth int
+}
+
+// Run watches the directories and installs the certificates in the new stores
+// until the context is canceled. It returns nil when the context is canceled.
+func (w *Watcher) Run(ctx context.Context) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return wrapError(err, "failed to initialize inotify")
+	}
+	// A non-blocking file uses the runtime poller, Close unblocks Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	dirs := make(map[int32]watchedDir)
+	var watch func(dir string, depth int)
+	watch = func(dir string, depth int) {
+		wd, err := syscall.InotifyAddWatch(fd, dir, watchEvents|syscall.IN_ONLYDIR)
+		if err != nil {
+			debug("failed to watch %s: %v", dir, err)
+			return
+		}
+		dirs[int32(wd)] = watchedDir{path: dir, depth: depth}
+		if depth == 0 {
+			return
+		}
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if e.IsDir() {
+				watch(filepath.Join(dir, e.Name()), depth-1)
+			}
+		}
+	}
+	// NSS: profile/cert9.db, Java: jdk/jre/lib/security/cacerts.
+	for _, dir := range w.NSSDirs {
+		watch(dir, 1)
+	}
+	for _, dir := range w.JavaDirs {
+		watch(dir, 4)
+	}
+	if len(dirs) == 0 {
+		return errors.New("none of the directories to watch exist")
+	}
+
+	w.scan()
+
+	events := make(chan inotifyEvent)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- readInotifyEvents(ctx, f, events)
+	}()
+
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			return wrapError(err, "failed to read inotify events")
+		case ev := <-events:
+			d, ok := dirs[ev.wd]
+			if !ok {
+				continue
+			}
+			if ev.mask&syscall.IN_ISDIR != 0 && d.depth > 0 {
+				watch(filepath.Join(d.path, ev.name), d.depth-1)
+			}
+			timer.Reset(watchDelay)
+		case <-timer.C:
+			w.scan()
+		}
+	}
+}
+
+// readInotifyEvents reads the events from the inotify file and sends them to
+// the channel until the file is closed or the context is canceled.
+func readInotifyEvents(ctx context.Context, f *os.File, events chan<- inotifyEvent) error {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent
+			// The name is padded with null bytes.
+			name := strings.TrimRight(string(buf[offset:offset+int(raw.Len)]), "\x00")
+			offset += int(raw.Len)
+			select {
+			case events <- inotifyEvent{wd: raw.Wd, mask: raw.Mask, name: name}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+// Copyright (c) 2018 The truststore Authors. All rights reserved.
+
+package truststore
+
+import "context"
+
+// Run watches the directories and installs the certificates in the new stores
+// until the context is canceled. It is only supported on Linux.
+func (w *Watcher) Run(context.Context) error {
+	return ErrNotSupported
+}
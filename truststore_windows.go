@@ -19,6 +19,10 @@ var (
 	// CertutilInstallHelp is the command to run on windows to add NSS support.
 	// Certutils is not supported on Windows.
 	CertutilInstallHelp = ""
+
+	// SystemBundleFiles are the possible locations of the system CA bundle.
+	// There is no CA bundle on Windows.
+	SystemBundleFiles []string
 )
 
 var (
@@ -70,6 +74,29 @@ func uninstallPlatform(filename string, cert *x509.Certificate) error {
 	return nil
 }
 
+// verifyPlatform checks that the certificate is trusted by the platform
+// verifier.
+func verifyPlatform(cert *x509.Certificate) error {
+	_, err := cert.Verify(x509.VerifyOptions{})
+	return err
+}
+
+// refreshPlatform does nothing, the root store is not backed up.
+func refreshPlatform() error {
+	return nil
+}
+
+// systemPaths returns nil, the root store is not kept in a file.
+func systemPaths(*x509.Certificate) []string {
+	return nil
+}
+
+// listPlatform is not supported on Windows, the root store does not keep the
+// names used by truststore.
+func listPlatform() ([]Entry, error) {
+	return nil, ErrNotSupported
+}
+
 type windowsRootStore uintptr
 
 func openWindowsRootStore() (windowsRootStore, error) {